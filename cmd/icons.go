@@ -0,0 +1,189 @@
+/*
+Copyright © 2024 Daniel Ciucur ciucur.daniel14@gmail.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/CiucurDaniel/terraview/internal/config"
+	"github.com/CiucurDaniel/terraview/internal/icons"
+	"github.com/CiucurDaniel/terraview/internal/tfconfigreader"
+	"github.com/spf13/cobra"
+)
+
+// Define the config-file and expired flags of the icons commands
+var iconsConfigFile string
+var purgeExpired bool
+
+// iconsCmd represents the icons command
+var iconsCmd = &cobra.Command{
+	Use:   "icons",
+	Short: "Manage the cache of downloaded icons",
+	Long: `Manage the cache of downloaded icons, kept in $XDG_CACHE_HOME/terraview/icons
+unless icons.cache_dir is set in the config file. For example:
+
+terraview icons list
+or
+terraview icons prefetch .\terraform_example\ --config-file terraview.yaml
+or
+terraview icons verify
+or
+terraview icons purge --expired`,
+}
+
+// iconsListCmd represents the icons list command
+var iconsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the cached icons",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cache, ok := loadIconCache()
+		if !ok {
+			return
+		}
+
+		entries, err := cache.Entries()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("ERROR: Could not read the icon cache: %v", err))
+			return
+		}
+		if len(entries) == 0 {
+			fmt.Println("INFO: The icon cache at " + cache.Dir + " is empty")
+			return
+		}
+
+		for _, entry := range entries {
+			status := "fresh"
+			if cache.Expired(entry) {
+				status = "expired"
+			}
+			fmt.Printf("%s  %s  %6d bytes  %-7s  fetched %s\n", entry.SHA256[:12], entry.URL, entry.Size, status, entry.FetchedAt.Format(time.RFC3339))
+		}
+	},
+}
+
+// iconsPrefetchCmd represents the icons prefetch command
+var iconsPrefetchCmd = &cobra.Command{
+	Use:   "prefetch [path]",
+	Short: "Download the icons of every resource type in the terraform code",
+	Long: `Download the icons of every resource type used by the terraform code at path, defaulting
+to the current directory, so later runs do not need the network.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path := "."
+		if len(args) == 1 {
+			path = args[0]
+		}
+		if !loadIconsConfig() {
+			return
+		}
+
+		module, err := tfconfigreader.LoadModule(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("failed to load configuration: %v", err))
+			return
+		}
+
+		pack, err := icons.NewPack(config.GetConfig())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("ERROR: Invalid icon configuration: %v", err))
+			return
+		}
+
+		resourceTypes := module.ResourceTypes()
+		found := pack.Resolve(resourceTypes)
+		for _, resourceType := range resourceTypes {
+			if _, ok := found[resourceType]; !ok {
+				fmt.Fprintln(os.Stderr, "WARNING: No icon found for "+resourceType)
+			}
+		}
+		fmt.Printf("INFO: Found icons for %d of %d resource types\n", len(found), len(resourceTypes))
+	},
+}
+
+// iconsVerifyCmd represents the icons verify command
+var iconsVerifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Check the cached icons against their checksums, removing corrupt ones",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cache, ok := loadIconCache()
+		if !ok {
+			return
+		}
+
+		broken, err := cache.Verify()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("ERROR: Could not verify the icon cache: %v", err))
+			return
+		}
+		for _, entry := range broken {
+			fmt.Fprintln(os.Stderr, "WARNING: Removed corrupt icon "+entry.URL)
+		}
+		fmt.Printf("INFO: %d corrupt icons found\n", len(broken))
+	},
+}
+
+// iconsPurgeCmd represents the icons purge command
+var iconsPurgeCmd = &cobra.Command{
+	Use:   "purge",
+	Short: "Remove the cached icons",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		cache, ok := loadIconCache()
+		if !ok {
+			return
+		}
+
+		removed, err := cache.Purge(purgeExpired)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("ERROR: Could not purge the icon cache: %v", err))
+			return
+		}
+		fmt.Printf("INFO: Removed %d icons from %s\n", removed, cache.Dir)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(iconsCmd)
+	iconsCmd.AddCommand(iconsListCmd, iconsPrefetchCmd, iconsVerifyCmd, iconsPurgeCmd)
+
+	// Define the config-file flag
+	iconsCmd.PersistentFlags().StringVarP(&iconsConfigFile, "config-file", "c", "", "Path to the configuration file. Defaults to built-in config if flag omitted")
+
+	// Define the expired flag
+	iconsPurgeCmd.Flags().BoolVar(&purgeExpired, "expired", false, "Only remove icons whose TTL expired")
+}
+
+// loadIconsConfig loads the configuration file if one was given.
+func loadIconsConfig() bool {
+	if iconsConfigFile == "" {
+		return true
+	}
+	if err := config.LoadConfig(iconsConfigFile); err != nil {
+		fmt.Fprintln(os.Stderr, fmt.Errorf("ERROR: Could not load config: %v", err))
+		return false
+	}
+	return true
+}
+
+// loadIconCache returns the icon cache of the configuration.
+func loadIconCache() (*icons.Cache, bool) {
+	if !loadIconsConfig() {
+		return nil, false
+	}
+
+	cache, err := icons.NewCacheFromConfig(config.GetConfig())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, fmt.Errorf("ERROR: %v", err))
+		return nil, false
+	}
+	if cache == nil {
+		fmt.Fprintln(os.Stderr, "ERROR: No cache directory found, set icons.cache_dir in the config file")
+		return nil, false
+	}
+	return cache, true
+}
@@ -7,42 +7,94 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/CiucurDaniel/terraview/internal/address"
 	"github.com/CiucurDaniel/terraview/internal/config"
+	"github.com/CiucurDaniel/terraview/internal/diagram"
+	"github.com/CiucurDaniel/terraview/internal/drift"
 	"github.com/CiucurDaniel/terraview/internal/graph"
+	"github.com/CiucurDaniel/terraview/internal/model"
 	"github.com/CiucurDaniel/terraview/internal/render"
+	"github.com/CiucurDaniel/terraview/internal/tfconfigreader"
+	"github.com/CiucurDaniel/terraview/internal/tfplanreader"
 	"github.com/CiucurDaniel/terraview/internal/tfstatereader"
 	"github.com/spf13/cobra"
 )
 
-// Define the format, url, and config-file flags
-var format string
+// Define the format, output, renderer, url, config-file, source, graph-file, plan, drift, collapse-module, allow-sensitive, icon-url and dump-after flags
+var formats []string
+var output string
+var rendererName string
 var url string
 var configFile string
+var source string
+var graphFile string
+var planFile string
+var showDrift bool
+var collapseModules []string
+var allowSensitive bool
+var iconURL string
+var dumpAfter []string
 
 // printCmd represents the print command
 var printCmd = &cobra.Command{
 	Use:   "print [path]",
 	Short: "Print diagram from terraform code",
-	Long: `Print diagram from terraform code. This command receives exactly one arg 
-representing the path to the main.tf file. For example:
+	Long: `Print diagram from terraform code. This command receives at most one arg
+representing the path to the main.tf file, defaulting to the current directory. For example:
 
 terraview print .\terraform_example\ --format png
 or
+terraview print .\terraform_example\ --source terraform
+or
+terraview print --graph-file .\3-tier-arhitecture\plan.dot
+or
+terraform graph | terraview print --source stdin
+or
+terraview print --source state --url "s3://my-bucket/terraform.tfstate"
+or
+terraview print .\terraform_example\ --plan plan.json
+or
+terraview print .\terraform_example\ --drift
+or
+terraview print .\terraform_example\ --collapse-module network
+or
+terraview print .\terraform_example\ --format svg --renderer dot
+or
+terraview print .\terraform_example\ --format html
+or
+terraview print .\terraform_example\ --format png,svg,dot --output docs/infra.{ext}
+or
+terraview print .\terraform_example\ --format dot --output -
+or
+terraview print .\terraform_example\ --dump-after module_clusters
+or
 terraview print ..\demo-company-project\terraform\ --format dot --config-file terraview.yaml --url "azurerm://@terraform-state/project0terraform0state/terraform-state/project"`,
-	Args: cobra.ExactArgs(1),
+	Args: cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		path := args[0]
+		path := "."
+		if len(args) == 1 {
+			path = args[0]
+		}
 
 		// Load the configuration if a config-file path is provided
 		if configFile != "" {
 			err := config.LoadConfig(configFile)
 			if err != nil {
-				fmt.Println(fmt.Errorf("ERROR: Could not load config: %v", err))
+				fmt.Fprintln(os.Stderr, fmt.Errorf("ERROR: Could not load config: %v", err))
 				return
 			}
 		}
 		cfg := config.GetConfig()
+		cfg.CollapseModules = append(cfg.CollapseModules, collapseModules...)
+		if allowSensitive {
+			fmt.Fprintln(os.Stderr, "WARNING: Sensitive values will be shown in the diagram")
+			cfg.AllowSensitive = true
+		}
+		if iconURL != "" {
+			cfg.IconURL = iconURL
+		}
 
 		// Determine the state file path from the url flag or the path argument
 		stateFilePath := url
@@ -50,35 +102,103 @@ terraview print ..\demo-company-project\terraform\ --format dot --config-file te
 			stateFilePath = filepath.Join(path, "terraform.tfstate")
 		}
 
-		// Create a TFStateHandler
+		// A graph file implies the file source unless another source was requested explicitly
+		if graphFile != "" && !cmd.Flags().Changed("source") {
+			source = "file"
+		}
+
+		// Create a TFStateHandler, a local configuration which was never applied has no state
 		handler, err := tfstatereader.NewTFStateHandler(stateFilePath)
 		if err != nil {
-			fmt.Println(fmt.Errorf("failed to create TFStateHandler: %v", err))
+			if url != "" {
+				fmt.Fprintln(os.Stderr, fmt.Errorf("failed to create TFStateHandler: %v", err))
+				return
+			}
+			fmt.Fprintln(os.Stderr, "WARNING: No state found at "+stateFilePath+", diagram will not contain attributes from state")
+			handler = nil
+		}
+
+		// Check the passes to dump after are part of the pipeline
+		dump, err := dumpFunc(cfg, dumpAfter)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("ERROR: %v", err))
+			return
+		}
+
+		// Select the rendering backend and check the output before doing any work
+		renderer, err := render.NewRenderer(rendererName)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("ERROR: %v", err))
+			return
+		}
+		if err := render.CheckOutput(output, formats); err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("ERROR: %v", err))
 			return
 		}
 
 		// Create a temporary directory to store downloaded images
 		tempDir, err := os.MkdirTemp("", "graphviz-images")
 		if err != nil {
-			fmt.Errorf("error creating temp directory: %v", err)
+			fmt.Fprintln(os.Stderr, fmt.Errorf("error creating temp directory: %v", err))
+			return
 		}
 		defer os.RemoveAll(tempDir)
 
-		futureDiagram, err := graph.PrepareGraphForPrinting(path, cfg, handler, tempDir)
+		graphSource, err := newGraphSource(source, path, handler)
 		if err != nil {
-			fmt.Println(fmt.Errorf("failed to prepare graph for printing: %v", err))
+			fmt.Fprintln(os.Stderr, fmt.Errorf("ERROR: %v", err))
 			return
 		}
 
-		// Determine the output format from the flag
-		if format == "" {
-			format = "png" // Default format
+		futureDiagram, err := graph.PrepareGraphForPrinting(graphSource, cfg, handler, tempDir, dump)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("failed to prepare graph for printing: %v", err))
+			return
 		}
 
-		// Save the graph in the specified format
-		err = render.SaveGraphAs(futureDiagram, "./diagram", format)
+		// Color the resources by the action planned for them
+		if planFile != "" {
+			plan, err := tfplanreader.LoadPlan(planFile, path)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, fmt.Errorf("failed to load plan: %v", err))
+				return
+			}
+			graph.ApplyPlan(futureDiagram, plan)
+		}
+
+		// Highlight the differences between configuration and state
+		if showDrift {
+			if handler == nil {
+				fmt.Fprintln(os.Stderr, "ERROR: Drift detection requires a terraform state")
+				return
+			}
+			module, err := tfconfigreader.LoadModule(path)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, fmt.Errorf("failed to load configuration: %v", err))
+				return
+			}
+			report := drift.Compare(module, handler.Raw)
+			report.Print(os.Stderr)
+			graph.ApplyDrift(futureDiagram, report)
+		}
+
+		// The interactive page and the model hold everything the state knows about a resource
+		var details map[string]model.Details
+		if address.Contains(formats, "html") || address.Contains(formats, "json") {
+			details = graph.Details(futureDiagram, handler)
+		}
+
+		// Only now the diagram becomes a Graphviz graph for the renderers
+		dot, err := futureDiagram.Graph()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("failed to convert diagram: %v", err))
+			return
+		}
+
+		// Save the graph in every requested format
+		err = render.SaveGraphAs(dot, output, formats, renderer, details)
 		if err != nil {
-			fmt.Println(fmt.Errorf("error occurred generating image: %v", err))
+			fmt.Fprintln(os.Stderr, fmt.Errorf("error occurred generating image: %v", err))
 		}
 	},
 }
@@ -87,7 +207,13 @@ func init() {
 	rootCmd.AddCommand(printCmd)
 
 	// Define the format flag
-	printCmd.Flags().StringVarP(&format, "format", "f", "png", "Output format (png, jpg, svg, pdf, dot)")
+	printCmd.Flags().StringSliceVarP(&formats, "format", "f", []string{"png"}, "Output formats (png, jpg, svg, pdf, dot, mermaid, drawio, html, json). Several can be given, e.g. png,svg,dot")
+
+	// Define the output flag
+	printCmd.Flags().StringVarP(&output, "output", "o", render.DefaultOutput, "Path to write to, or - for stdout. {ext}, {format} and {timestamp} are replaced, e.g. docs/diagram_{timestamp}.{ext}")
+
+	// Define the renderer flag
+	printCmd.Flags().StringVar(&rendererName, "renderer", "builtin", "Rendering backend (builtin, dot). builtin needs no Graphviz installation, dot runs the Graphviz dot binary")
 
 	// Define the url flag
 	printCmd.Flags().StringVarP(&url, "url", "u", "", "URL to the terraform state file (local file, http/https, s3, remote, gs, azurerm). Defaults to local if flag omitted")
@@ -95,6 +221,30 @@ func init() {
 	// Define the config-file flag
 	printCmd.Flags().StringVarP(&configFile, "config-file", "c", "", "Path to the configuration file. Defaults to built-in config if flag omitted")
 
+	// Define the source flag
+	printCmd.Flags().StringVarP(&source, "source", "s", "hcl", "Where the dependency graph comes from (hcl, terraform, file, stdin, state). hcl parses the .tf files and does not need terraform init")
+
+	// Define the graph-file flag
+	printCmd.Flags().StringVarP(&graphFile, "graph-file", "g", "", "Path to a DOT file generated with terraform graph, or - for stdin. Implies --source file")
+
+	// Define the plan flag
+	printCmd.Flags().StringVarP(&planFile, "plan", "p", "", "Path to a plan file or its terraform show -json export. Colors resources by their planned action")
+
+	// Define the drift flag
+	printCmd.Flags().BoolVarP(&showDrift, "drift", "d", false, "Highlight resources whose configuration and state disagree and print a report")
+
+	// Define the collapse-module flag
+	printCmd.Flags().StringSliceVar(&collapseModules, "collapse-module", nil, "Draw a module as a single box showing its inputs and outputs. Can be repeated, e.g. network or module.network.module.subnets")
+
+	// Define the allow-sensitive flag
+	printCmd.Flags().BoolVar(&allowSensitive, "allow-sensitive", false, "Show the values of sensitive attributes instead of masking them")
+
+	// Define the icon-url flag
+	printCmd.Flags().StringVar(&iconURL, "icon-url", "", "Base URL to download icons from which are not bundled, as <url>/<provider>/<resource type>.png. Icons are only downloaded if set")
+
+	// Define the dump-after flag
+	printCmd.Flags().StringSliceVar(&dumpAfter, "dump-after", nil, "Write the diagram as DOT to after_<pass>.dot once the given pass ran, for debugging the pipeline. Can be repeated")
+
 	// Here you will define your flags and configuration settings.
 
 	// Cobra supports Persistent Flags which will work for this command
@@ -105,3 +255,68 @@ func init() {
 	// is called directly, e.g.:
 	// printCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
+
+// newGraphSource returns the graph source selected by the source flag.
+func newGraphSource(source, path string, handler *tfstatereader.TFStateHandler) (graph.GraphSource, error) {
+	switch source {
+	case "hcl":
+		return &graph.ConfigSource{Dir: path}, nil
+	case "terraform":
+		return &graph.TerraformSource{Dir: path}, nil
+	case "file":
+		if graphFile == "" {
+			return nil, fmt.Errorf("source file requires the --graph-file flag")
+		}
+		if graphFile == "-" {
+			return &graph.ReaderSource{Reader: os.Stdin}, nil
+		}
+		return &graph.FileSource{Path: graphFile}, nil
+	case "stdin":
+		return &graph.ReaderSource{Reader: os.Stdin}, nil
+	case "state":
+		if handler == nil {
+			return nil, fmt.Errorf("source state requires a readable terraform state, use --url or the path argument")
+		}
+		return &graph.StateSource{Handler: handler}, nil
+	default:
+		return nil, fmt.Errorf("unknown source %s, expected hcl, terraform, file, stdin or state", source)
+	}
+}
+
+// dumpFunc returns the function writing the diagram after the given passes, nil when there are none.
+// Every pass must be part of the pipeline.
+func dumpFunc(cfg *config.Config, passes []string) (graph.DumpFunc, error) {
+	if len(passes) == 0 {
+		return nil, nil
+	}
+
+	steps, err := graph.Pipeline(cfg)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, step := range steps {
+		names = append(names, step.Pass)
+	}
+	for _, pass := range passes {
+		if !address.Contains(names, pass) {
+			return nil, fmt.Errorf("pass %s is not part of the pipeline: %s", pass, strings.Join(names, ", "))
+		}
+	}
+
+	return func(pass string, d *diagram.Diagram) error {
+		if !address.Contains(passes, pass) {
+			return nil
+		}
+		dot, err := d.Graph()
+		if err != nil {
+			return err
+		}
+		path := "after_" + pass + ".dot"
+		if err := os.WriteFile(path, []byte(dot.String()), 0644); err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, "Wrote "+path)
+		return nil
+	}, nil
+}
@@ -0,0 +1,93 @@
+/*
+Copyright © 2024 Daniel Ciucur ciucur.daniel14@gmail.com
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/CiucurDaniel/terraview/internal/model"
+	"github.com/CiucurDaniel/terraview/internal/render"
+	"github.com/spf13/cobra"
+)
+
+// Define the from, format, output and renderer flags of the render command
+var modelFile string
+var renderFormats []string
+var renderOutput string
+var renderRendererName string
+
+// renderCmd represents the render command
+var renderCmd = &cobra.Command{
+	Use:   "render",
+	Short: "Render a diagram from a model written with --format json",
+	Long: `Render a diagram from a model written by "terraview print --format json",
+possibly edited or generated by other tools. Neither terraform nor the state is read again. For example:
+
+terraview render --from model.json --format svg,png --output docs/infra.{ext}
+or
+cat model.json | terraview render --from - --format html`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		m, err := readModel(modelFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("ERROR: %v", err))
+			return
+		}
+
+		renderer, err := render.NewRenderer(renderRendererName)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("ERROR: %v", err))
+			return
+		}
+		if err := render.CheckOutput(renderOutput, renderFormats); err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("ERROR: %v", err))
+			return
+		}
+
+		// The icons embedded in the model are written to a temporary directory for the renderers
+		tempDir, err := os.MkdirTemp("", "graphviz-images")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("error creating temp directory: %v", err))
+			return
+		}
+		defer os.RemoveAll(tempDir)
+
+		diagram, err := m.Graph(tempDir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("ERROR: Could not convert the model: %v", err))
+			return
+		}
+
+		err = render.SaveGraphAs(diagram, renderOutput, renderFormats, renderer, m.Details())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, fmt.Errorf("error occurred generating image: %v", err))
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(renderCmd)
+
+	renderCmd.Flags().StringVar(&modelFile, "from", "", "Path to the model file, or - for stdin")
+	renderCmd.MarkFlagRequired("from")
+	renderCmd.Flags().StringSliceVarP(&renderFormats, "format", "f", []string{"png"}, "Output formats (png, jpg, svg, pdf, dot, mermaid, drawio, html, json). Several can be given, e.g. png,svg,dot")
+	renderCmd.Flags().StringVarP(&renderOutput, "output", "o", render.DefaultOutput, "Path to write to, or - for stdout. {ext}, {format} and {timestamp} are replaced, e.g. docs/diagram_{timestamp}.{ext}")
+	renderCmd.Flags().StringVar(&renderRendererName, "renderer", "builtin", "Rendering backend (builtin, dot). builtin needs no Graphviz installation, dot runs the Graphviz dot binary")
+}
+
+// readModel reads a model from a file, or from stdin for -.
+func readModel(path string) (*model.Model, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not open model: %v", err)
+		}
+		defer file.Close()
+		r = file
+	}
+	return model.Read(r)
+}
@@ -0,0 +1,225 @@
+package address
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// identifier matches the names Terraform allows for resource types, resource names and module calls.
+var identifier = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_-]*$`)
+
+// reservedTypes can not be resource types, they start references to other objects, e.g. var.location
+var reservedTypes = map[string]bool{
+	"var": true, "local": true, "output": true, "path": true, "terraform": true,
+	"count": true, "each": true, "self": true, "provider": true, "resource": true,
+}
+
+// ModuleStep is one module call on the path to a resource, e.g. module.app["web"]
+type ModuleStep struct {
+	Name string
+	Key  string // instance key as written in the address, e.g. 0 or "web", empty when not expanded
+}
+
+// String returns the step as written in an address.
+func (s ModuleStep) String() string {
+	if s.Key == "" {
+		return "module." + s.Name
+	}
+	return "module." + s.Name + "[" + s.Key + "]"
+}
+
+// Address is a parsed Terraform resource address like module.net[0].data.azurerm_subnet.this["web"]
+// An address without type refers to a module call, e.g. module.net
+type Address struct {
+	Module []ModuleStep
+	Mode   string // "managed" or "data", empty for module calls
+	Type   string
+	Name   string
+	Key    string // instance key as written in the address, e.g. 0 or "web", empty when not expanded
+}
+
+// Parse parses a resource or module call address following the Terraform address grammar. Quotes around
+// the whole address, as found in DOT node names, are removed first. Anything else, like var.location or
+// provider["registry.terraform.io/hashicorp/azurerm"], is rejected.
+func Parse(s string) (Address, error) {
+	s = Unquote(s)
+	rest := s
+
+	var addr Address
+	for strings.HasPrefix(rest, "module.") {
+		rest = rest[len("module."):]
+		name, key, remaining, err := readStep(rest)
+		if err != nil {
+			return Address{}, fmt.Errorf("invalid address %s: %v", s, err)
+		}
+		if !identifier.MatchString(name) {
+			return Address{}, fmt.Errorf("invalid address %s: invalid module name %s", s, name)
+		}
+		addr.Module = append(addr.Module, ModuleStep{Name: name, Key: key})
+		rest = remaining
+		if rest == "" {
+			return addr, nil
+		}
+		if !strings.HasPrefix(rest, ".") {
+			return Address{}, fmt.Errorf("invalid address %s", s)
+		}
+		rest = rest[1:]
+	}
+
+	addr.Mode = "managed"
+	if strings.HasPrefix(rest, "data.") {
+		addr.Mode = "data"
+		rest = rest[len("data."):]
+	}
+
+	dot := strings.Index(rest, ".")
+	if dot <= 0 {
+		return Address{}, fmt.Errorf("invalid address %s: missing resource name", s)
+	}
+	addr.Type = rest[:dot]
+	if !identifier.MatchString(addr.Type) || reservedTypes[addr.Type] {
+		return Address{}, fmt.Errorf("invalid address %s: invalid resource type %s", s, addr.Type)
+	}
+
+	name, key, remaining, err := readStep(rest[dot+1:])
+	if err != nil {
+		return Address{}, fmt.Errorf("invalid address %s: %v", s, err)
+	}
+	if remaining != "" {
+		return Address{}, fmt.Errorf("invalid address %s: unexpected %s", s, remaining)
+	}
+	if !identifier.MatchString(name) {
+		return Address{}, fmt.Errorf("invalid address %s: invalid resource name %s", s, name)
+	}
+	addr.Name = name
+	addr.Key = key
+
+	return addr, nil
+}
+
+// readStep reads a name with an optional instance key and returns what follows it.
+func readStep(s string) (name, key, rest string, err error) {
+	end := strings.IndexAny(s, ".[")
+	if end < 0 {
+		return s, "", "", nil
+	}
+	name = s[:end]
+	if name == "" {
+		return "", "", "", fmt.Errorf("empty name")
+	}
+	if s[end] == '.' {
+		return name, "", s[end:], nil
+	}
+
+	// Find the closing bracket, ignoring brackets inside a quoted key
+	inString := false
+	for i := end + 1; i < len(s); i++ {
+		switch {
+		case inString && s[i] == '\\':
+			i++
+		case s[i] == '"':
+			inString = !inString
+		case !inString && s[i] == ']':
+			return name, s[end+1 : i], s[i+1:], nil
+		}
+	}
+	return "", "", "", fmt.Errorf("unterminated instance key")
+}
+
+// IsModuleCall checks if the address refers to a module call rather than a resource.
+func (a Address) IsModuleCall() bool {
+	return a.Type == ""
+}
+
+// ModulePath returns the module part of the address, e.g. module.net[0].module.subnets
+func (a Address) ModulePath() string {
+	steps := make([]string, len(a.Module))
+	for i, step := range a.Module {
+		steps[i] = step.String()
+	}
+	return strings.Join(steps, ".")
+}
+
+// ConfigModulePath returns the module path without instance keys, as it appears in the configuration.
+func (a Address) ConfigModulePath() string {
+	steps := make([]string, len(a.Module))
+	for i, step := range a.Module {
+		steps[i] = "module." + step.Name
+	}
+	return strings.Join(steps, ".")
+}
+
+// Resource returns the resource part without module path and key, e.g. azurerm_subnet.this or data.azurerm_client_config.current
+func (a Address) Resource() string {
+	if a.IsModuleCall() {
+		return ""
+	}
+	if a.Mode == "data" {
+		return "data." + a.Type + "." + a.Name
+	}
+	return a.Type + "." + a.Name
+}
+
+// WithoutKey returns the address of the whole resource the instance belongs to.
+func (a Address) WithoutKey() Address {
+	a.Key = ""
+	return a
+}
+
+// WithoutModuleKeys returns the address with the instance keys of its module calls removed, the way terraform
+// records dependencies, e.g. module.net.azurerm_subnet.this for module.net[0].azurerm_subnet.this
+func (a Address) WithoutModuleKeys() Address {
+	steps := make([]ModuleStep, len(a.Module))
+	for i, step := range a.Module {
+		steps[i] = ModuleStep{Name: step.Name}
+	}
+	a.Module = steps
+	return a
+}
+
+// Covers checks if b is an instance of the resource a refers to: both name the same resource in the same
+// module calls and b has a's instance keys wherever a has one. The unexpanded module.net.azurerm_subnet.this
+// covers module.net[0].azurerm_subnet.this["web"], while module.net[1].azurerm_subnet.this does not.
+func (a Address) Covers(b Address) bool {
+	if a.IsModuleCall() || a.Resource() != b.Resource() || len(a.Module) != len(b.Module) {
+		return false
+	}
+	for i, step := range a.Module {
+		if step.Name != b.Module[i].Name || (step.Key != "" && step.Key != b.Module[i].Key) {
+			return false
+		}
+	}
+	return a.Key == "" || a.Key == b.Key
+}
+
+// SameModuleInstances checks if two addresses agree on the instance keys of the module calls their paths share,
+// so module.net[0].azurerm_subnet.this and module.net[0].azurerm_virtual_network.this do while
+// module.net[1].azurerm_virtual_network.this does not. A step without key agrees with every key.
+func (a Address) SameModuleInstances(b Address) bool {
+	for i := 0; i < len(a.Module) && i < len(b.Module); i++ {
+		if a.Module[i].Name != b.Module[i].Name {
+			return true
+		}
+		if a.Module[i].Key != "" && b.Module[i].Key != "" && a.Module[i].Key != b.Module[i].Key {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the address in Terraform notation.
+func (a Address) String() string {
+	var parts []string
+	if len(a.Module) > 0 {
+		parts = append(parts, a.ModulePath())
+	}
+	if !a.IsModuleCall() {
+		resource := a.Resource()
+		if a.Key != "" {
+			resource += "[" + a.Key + "]"
+		}
+		parts = append(parts, resource)
+	}
+	return strings.Join(parts, ".")
+}
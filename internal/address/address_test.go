@@ -0,0 +1,141 @@
+package address
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Address
+	}{
+		{
+			input: "azurerm_subnet.this",
+			want:  Address{Mode: "managed", Type: "azurerm_subnet", Name: "this"},
+		},
+		{
+			input: `"azurerm_subnet.this[\"web\"]"`,
+			want:  Address{Mode: "managed", Type: "azurerm_subnet", Name: "this", Key: `"web"`},
+		},
+		{
+			input: "data.azurerm_client_config.current",
+			want:  Address{Mode: "data", Type: "azurerm_client_config", Name: "current"},
+		},
+		{
+			input: `module.net[0].module.subnets["a.b"].azurerm_subnet.this[1]`,
+			want: Address{
+				Module: []ModuleStep{{Name: "net", Key: "0"}, {Name: "subnets", Key: `"a.b"`}},
+				Mode:   "managed", Type: "azurerm_subnet", Name: "this", Key: "1",
+			},
+		},
+		{
+			input: "module.net",
+			want:  Address{Module: []ModuleStep{{Name: "net"}}},
+		},
+	}
+
+	for _, test := range tests {
+		got, err := Parse(test.input)
+		if err != nil {
+			t.Errorf("Parse(%s) returned error: %v", test.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Parse(%s) = %+v, want %+v", test.input, got, test.want)
+		}
+	}
+}
+
+func TestParseRejectsOtherReferences(t *testing.T) {
+	inputs := []string{
+		"",
+		"var.location",
+		"local.tags",
+		`provider["registry.terraform.io/hashicorp/azurerm"]`,
+		"azurerm_subnet",
+		"azurerm_subnet.this.id",
+		`azurerm_subnet.this["web"`,
+		"module.",
+	}
+
+	for _, input := range inputs {
+		if got, err := Parse(input); err == nil {
+			t.Errorf("Parse(%s) = %+v, want error", input, got)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	inputs := []string{
+		"azurerm_subnet.this",
+		`azurerm_subnet.this["web"]`,
+		"data.azurerm_client_config.current",
+		`module.net[0].module.subnets["a"].azurerm_subnet.this[1]`,
+		"module.net[0]",
+	}
+
+	for _, input := range inputs {
+		addr, err := Parse(input)
+		if err != nil {
+			t.Fatalf("Parse(%s) returned error: %v", input, err)
+		}
+		if got := addr.String(); got != input {
+			t.Errorf("Parse(%s).String() = %s", input, got)
+		}
+	}
+}
+
+func TestCovers(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"module.net.azurerm_subnet.this", `module.net[0].azurerm_subnet.this["web"]`, true},
+		{"module.net[0].azurerm_subnet.this", `module.net[0].azurerm_subnet.this["web"]`, true},
+		{"module.net[1].azurerm_subnet.this", "module.net[0].azurerm_subnet.this", false},
+		{`azurerm_subnet.this["web"]`, `azurerm_subnet.this["db"]`, false},
+		{"azurerm_subnet.this", "data.azurerm_subnet.this", false},
+		{"azurerm_subnet.this", "module.net.azurerm_subnet.this", false},
+	}
+
+	for _, test := range tests {
+		a, _ := Parse(test.a)
+		b, _ := Parse(test.b)
+		if got := a.Covers(b); got != test.want {
+			t.Errorf("%s covers %s = %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestSameModuleInstances(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"module.net[0].azurerm_subnet.this", "module.net[0].azurerm_virtual_network.this", true},
+		{"module.net[0].azurerm_subnet.this", "module.net[1].azurerm_virtual_network.this", false},
+		{"module.net[0].azurerm_subnet.this", "module.net.azurerm_virtual_network.this", true},
+		{"module.net[0].azurerm_subnet.this", "azurerm_resource_group.rg", true},
+		{"module.net[0].azurerm_subnet.this", "module.app[1].azurerm_linux_virtual_machine.vm", true},
+	}
+
+	for _, test := range tests {
+		a, _ := Parse(test.a)
+		b, _ := Parse(test.b)
+		if got := a.SameModuleInstances(b); got != test.want {
+			t.Errorf("%s and %s in same module instances = %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestQuote(t *testing.T) {
+	input := `azurerm_subnet.this["web"]`
+	quoted := Quote(input)
+	if want := `"azurerm_subnet.this[\"web\"]"`; quoted != want {
+		t.Errorf("Quote(%s) = %s, want %s", input, quoted, want)
+	}
+	if got := Unquote(quoted); got != input {
+		t.Errorf("Unquote(%s) = %s, want %s", quoted, got, input)
+	}
+}
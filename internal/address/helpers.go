@@ -0,0 +1,42 @@
+package address
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Quote quotes an address for use as a DOT node name, escaping inner quotes, e.g. azurerm_subnet.this["web"]
+// becomes "azurerm_subnet.this[\"web\"]". It is the inverse of Unquote.
+func Quote(s string) string {
+	return fmt.Sprintf(`"%s"`, strings.ReplaceAll(s, `"`, `\"`))
+}
+
+// Unquote removes the quotes of a DOT node name and unescapes inner quotes. Names without quotes are returned as they are.
+func Unquote(s string) string {
+	if len(s) >= 2 && strings.HasPrefix(s, `"`) && strings.HasSuffix(s, `"`) {
+		s = s[1 : len(s)-1]
+		s = strings.ReplaceAll(s, `\"`, `"`)
+	}
+	return s
+}
+
+// SortedKeys returns the keys of a map in ascending order.
+func SortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Contains checks if value is one of values.
+func Contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
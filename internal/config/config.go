@@ -3,57 +3,113 @@ package config
 import (
 	"fmt"
 	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"strings"
 	"sync"
 
 	"gopkg.in/yaml.v3"
 )
 
-// Resource defines a resource with its attributes
+// Resource defines a resource with its attributes.
+// Name may contain wildcards, e.g. azurerm_* or *, and attributes may be paths
+// like os_disk[0].storage_account_type, tags.environment or ip_configuration[*].private_ip_address
+// Label is an optional text/template replacing the default label, e.g. {{.Attr "name"}} ({{.Attr "size"}})
 type Resource struct {
 	Name       string   `yaml:"resource"`
 	Attributes []string `yaml:"attributes"`
+	Label      string   `yaml:"label"`
+}
+
+// Sensitive lists attributes whose values are masked, on top of those marked sensitive in the state.
+// Attributes are matched by name and patterns are regular expressions matched against the name,
+// at any depth, e.g. admin_password or (?i)password$
+type Sensitive struct {
+	Attributes []string `yaml:"attributes"`
+	Patterns   []string `yaml:"patterns"`
 }
 
 // Config struct to hold the configuration data
 type Config struct {
 	GroupingElements    []string   `yaml:"grouping_elements"`
 	ImportantAttributes []Resource `yaml:"important_attributes"`
+	CollapseModules     []string   `yaml:"collapse_modules"`
+	Sensitive           Sensitive  `yaml:"sensitive"`
+	Icons               Icons      `yaml:"icons"`
+
+	// Providers selects the provider packs to apply, by default they are detected from the resources
+	Providers []string `yaml:"providers"`
+
+	// IconURL is where icons which are not bundled are downloaded from when no icon sources are configured
+	IconURL string `yaml:"icon_url"`
+
+	// StackInstances maps resource types, which may contain wildcards, to the number of instances above which
+	// the instances of a resource are drawn as one stacked node, e.g. azurerm_linux_virtual_machine: 3
+	StackInstances map[string]int `yaml:"stack_instances"`
+
+	// Pipeline replaces the default sequence of passes turning the dependency graph into a diagram
+	Pipeline []PipelineStep `yaml:"pipeline"`
+
+	// AllowSensitive shows sensitive values instead of masking them, it can only be set with --allow-sensitive
+	AllowSensitive bool `yaml:"-"`
+
+	patterns []*regexp.Regexp
+}
+
+// PipelineStep runs one pass of the pipeline, by the name it is registered under. A step can be switched off
+// with enabled: false and params are specific to the pass, e.g. {margin: 1.0} for node_margins.
+type PipelineStep struct {
+	Pass    string                 `yaml:"pass"`
+	Enabled *bool                  `yaml:"enabled"`
+	Params  map[string]interface{} `yaml:"params"`
+}
+
+// IsEnabled checks if the step runs, which it does unless enabled is false.
+func (s PipelineStep) IsEnabled() bool {
+	return s.Enabled == nil || *s.Enabled
+}
+
+// IconSource is one place icons are looked up in, exactly one of the fields must be set.
+// URL is a template with {provider} and {type} placeholders, e.g. https://example.com/{provider}/{type}.png
+type IconSource struct {
+	Dir      string `yaml:"dir"`
+	URL      string `yaml:"url"`
+	Embedded bool   `yaml:"embedded"`
+}
+
+// Icons configures where the icons of resources come from. Sources are tried in order, overrides map a
+// resource type to a file or URL and fallbacks map a category (compute, network, storage, database or
+// default for everything else) to the icon used for resources of that category without an icon of their own.
+// Downloaded icons are cached in CacheDir, where a leading ~ is the home directory, $XDG_CACHE_HOME/terraview/icons
+// by default, for CacheTTL, e.g. 24h
+type Icons struct {
+	Sources   []IconSource      `yaml:"sources"`
+	Overrides map[string]string `yaml:"overrides"`
+	Fallbacks map[string]string `yaml:"fallbacks"`
+	CacheDir  string            `yaml:"cache_dir"`
+	CacheTTL  string            `yaml:"cache_ttl"`
+}
+
+// SensitiveMask replaces the values of sensitive attributes.
+const SensitiveMask = "(sensitive)"
+
+// defaultSensitive is always applied, so a custom config can not accidentally expose secrets.
+var defaultSensitive = Sensitive{
+	Attributes: []string{"admin_password", "custom_data", "user_data"},
+	Patterns:   []string{`(?i)(password|secret|token|private_key|access_key|connection_string)s?$`},
 }
 
 var (
-	// Initialize globalConfig with default values
-	globalConfig = &Config{
-		GroupingElements: []string{
-			"azurerm_subnet",
-			"azurerm_virtual_network",
-			"azurerm_resource_group",
-		},
-		ImportantAttributes: []Resource{
-			{
-				Name:       "azurerm_linux_virtual_machine",
-				Attributes: []string{"size"},
-			},
-			{
-				Name:       "azurerm_subnet",
-				Attributes: []string{"address_prefixes"},
-			},
-			{
-				Name:       "azurerm_virtual_network",
-				Attributes: []string{"address_space"},
-			},
-			{
-				Name:       "azurerm_resource_group",
-				Attributes: []string{"location"},
-			},
-		},
-	}
+	// Initialize globalConfig empty, the defaults come from the packs of the providers in use
+	globalConfig = &Config{}
 	// mutex to ensure thread-safe access to globalConfig
 	mutex sync.Mutex
 )
 
 // LoadConfig loads the configuration from a YAML file into the globalConfig variable
 func LoadConfig(filePath string) error {
-	fmt.Println("INFO: User provided custom configuration at " + filePath)
+	fmt.Fprintln(os.Stderr, "INFO: User provided custom configuration at "+filePath)
 
 	data, err := ioutil.ReadFile(filePath)
 	if err != nil {
@@ -66,6 +122,10 @@ func LoadConfig(filePath string) error {
 		return fmt.Errorf("error unmarshaling config: %v", err)
 	}
 
+	if err := config.compileSensitivePatterns(); err != nil {
+		return err
+	}
+
 	// Safely assign the config to the globalConfig variable
 	mutex.Lock()
 	globalConfig = &config
@@ -74,6 +134,118 @@ func LoadConfig(filePath string) error {
 	return nil
 }
 
+// AttributesFor returns the important attributes of a resource type, merging every entry whose name
+// matches the type either exactly or through a wildcard, in the order they are configured.
+func (c *Config) AttributesFor(resourceType string) []string {
+	var attributes []string
+	seen := make(map[string]bool)
+	for _, resource := range c.ImportantAttributes {
+		if matched, _ := path.Match(resource.Name, resourceType); !matched {
+			continue
+		}
+		for _, attribute := range resource.Attributes {
+			if !seen[attribute] {
+				seen[attribute] = true
+				attributes = append(attributes, attribute)
+			}
+		}
+	}
+	return attributes
+}
+
+// LabelTemplateFor returns the label template of a resource type. An entry naming the type exactly
+// wins over wildcard entries, which are tried in the order they are configured.
+func (c *Config) LabelTemplateFor(resourceType string) string {
+	var wildcard string
+	for _, resource := range c.ImportantAttributes {
+		if resource.Label == "" {
+			continue
+		}
+		if resource.Name == resourceType {
+			return resource.Label
+		}
+		if matched, _ := path.Match(resource.Name, resourceType); matched && wildcard == "" {
+			wildcard = resource.Label
+		}
+	}
+	return wildcard
+}
+
+// StackThresholdFor returns the number of instances of a resource type above which they are stacked, 0 when
+// they never are. An entry naming the type exactly wins over wildcard entries, of which the longest matching wins.
+func (c *Config) StackThresholdFor(resourceType string) int {
+	if threshold, exists := c.StackInstances[resourceType]; exists {
+		return threshold
+	}
+
+	var pattern string
+	for name := range c.StackInstances {
+		if matched, _ := path.Match(name, resourceType); !matched {
+			continue
+		}
+		if len(name) > len(pattern) || (len(name) == len(pattern) && name < pattern) {
+			pattern = name
+		}
+	}
+	return c.StackInstances[pattern]
+}
+
+// IconSources returns the configured icon sources. Without any, the bundled icons are used, followed by
+// the icon_url if set.
+func (c *Config) IconSources() []IconSource {
+	if len(c.Icons.Sources) > 0 {
+		return c.Icons.Sources
+	}
+
+	sources := []IconSource{{Embedded: true}}
+	if c.IconURL != "" {
+		sources = append(sources, IconSource{URL: strings.TrimSuffix(c.IconURL, "/") + "/{provider}/{type}.png"})
+	}
+	return sources
+}
+
+// IsSensitive checks if the values of an attribute, or of a map key, with the given name must be masked.
+func (c *Config) IsSensitive(name string) bool {
+	if c.AllowSensitive {
+		return false
+	}
+
+	for _, attributes := range [][]string{defaultSensitive.Attributes, c.Sensitive.Attributes} {
+		for _, attribute := range attributes {
+			if attribute == name {
+				return true
+			}
+		}
+	}
+
+	if c.patterns == nil {
+		if err := c.compileSensitivePatterns(); err != nil {
+			// Patterns are validated when the config is loaded, mask everything rather than leak
+			return true
+		}
+	}
+	for _, pattern := range c.patterns {
+		if pattern.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// compileSensitivePatterns compiles the default and the configured patterns.
+func (c *Config) compileSensitivePatterns() error {
+	patterns := make([]*regexp.Regexp, 0, len(defaultSensitive.Patterns)+len(c.Sensitive.Patterns))
+	for _, expr := range append(append([]string{}, defaultSensitive.Patterns...), c.Sensitive.Patterns...) {
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return fmt.Errorf("invalid sensitive pattern %s: %v", expr, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	c.patterns = patterns
+	return nil
+}
+
 // GetConfig returns the globalConfig instance
 func GetConfig() *Config {
 	mutex.Lock()
@@ -0,0 +1,92 @@
+package config
+
+import "github.com/CiucurDaniel/terraview/internal/address"
+
+// ProviderPack holds the defaults for the resources of one provider.
+type ProviderPack struct {
+	GroupingElements    []string
+	ImportantAttributes []Resource
+}
+
+// ProviderPacks are the built-in packs by provider name, the prefix of its resource types.
+var ProviderPacks = map[string]ProviderPack{
+	"azurerm": {
+		GroupingElements: []string{
+			"azurerm_subnet",
+			"azurerm_virtual_network",
+			"azurerm_resource_group",
+		},
+		ImportantAttributes: []Resource{
+			{Name: "azurerm_linux_virtual_machine", Attributes: []string{"size"}},
+			{Name: "azurerm_subnet", Attributes: []string{"address_prefixes"}},
+			{Name: "azurerm_virtual_network", Attributes: []string{"address_space"}},
+			{Name: "azurerm_resource_group", Attributes: []string{"location"}},
+		},
+	},
+	"aws": {
+		GroupingElements: []string{
+			"aws_subnet",
+			"aws_vpc",
+		},
+		ImportantAttributes: []Resource{
+			{Name: "aws_instance", Attributes: []string{"instance_type"}},
+			{Name: "aws_vpc", Attributes: []string{"cidr_block"}},
+			{Name: "aws_subnet", Attributes: []string{"cidr_block", "availability_zone"}},
+			{Name: "aws_db_instance", Attributes: []string{"engine", "instance_class"}},
+			{Name: "aws_lb", Attributes: []string{"load_balancer_type"}},
+			{Name: "aws_s3_bucket", Attributes: []string{"bucket"}},
+		},
+	},
+	"google": {
+		GroupingElements: []string{
+			"google_compute_subnetwork",
+			"google_compute_network",
+			"google_project",
+		},
+		ImportantAttributes: []Resource{
+			{Name: "google_compute_instance", Attributes: []string{"machine_type", "zone"}},
+			{Name: "google_compute_network", Attributes: []string{"routing_mode"}},
+			{Name: "google_compute_subnetwork", Attributes: []string{"ip_cidr_range", "region"}},
+			{Name: "google_project", Attributes: []string{"project_id"}},
+			{Name: "google_sql_database_instance", Attributes: []string{"database_version", "settings[0].tier"}},
+			{Name: "google_storage_bucket", Attributes: []string{"location", "storage_class"}},
+		},
+	},
+}
+
+// ApplyProviderPacks adds the grouping elements and important attributes of the packs of the given
+// providers, after the ones already configured. When the config lists providers only their packs are used.
+func (c *Config) ApplyProviderPacks(detected []string) {
+	providers := detected
+	if c.Providers != nil {
+		providers = c.Providers
+	}
+
+	for _, provider := range providers {
+		pack, ok := ProviderPacks[provider]
+		if !ok {
+			continue
+		}
+
+		for _, element := range pack.GroupingElements {
+			if !address.Contains(c.GroupingElements, element) {
+				c.GroupingElements = append(c.GroupingElements, element)
+			}
+		}
+		for _, resource := range pack.ImportantAttributes {
+			if !c.hasResource(resource.Name) {
+				c.ImportantAttributes = append(c.ImportantAttributes, resource)
+			}
+		}
+	}
+}
+
+// hasResource checks if the config already has an important_attributes entry for a resource name.
+func (c *Config) hasResource(name string) bool {
+	for _, resource := range c.ImportantAttributes {
+		if resource.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,34 @@
+package dag
+
+// ReduceTransitively removes every edge a -> c for which a longer path a -> b -> ... -> c exists,
+// the same reduction terraform applies before printing its graph.
+// Edges are given as a map from source to the set of destinations and are modified in place.
+func ReduceTransitively(edges map[string]map[string]bool) {
+	for src, targets := range edges {
+		for dst := range targets {
+			for via := range targets {
+				if via != dst && Reaches(edges, via, dst, map[string]bool{src: true}) {
+					delete(targets, dst)
+					break
+				}
+			}
+		}
+	}
+}
+
+// Reaches checks if dst can be reached from src following the edges, skipping nodes already visited.
+func Reaches(edges map[string]map[string]bool, src, dst string, visited map[string]bool) bool {
+	if src == dst {
+		return true
+	}
+	if visited[src] {
+		return false
+	}
+	visited[src] = true
+	for next := range edges[src] {
+		if Reaches(edges, next, dst, visited) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,327 @@
+// Package diagram holds the typed model the passes of internal/graph work on: the resources and their instances
+// with parsed addresses, the groups drawn around them and the edges between them. A diagram is built from the
+// graph of a source and only converted to a Graphviz graph once every pass ran.
+package diagram
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/CiucurDaniel/terraview/internal/address"
+)
+
+// Types of edges
+const (
+	EdgeDependency = "dependency" // read from the dependency graph
+	EdgeReference  = "reference"  // an attribute holding the id of another resource, labeled with the attribute
+)
+
+// GroupKind tells what a group stands for.
+type GroupKind string
+
+// Kinds of groups
+const (
+	GroupModule   GroupKind = "module"
+	GroupResource GroupKind = "resource"
+	GroupOther    GroupKind = "other"
+)
+
+// Attrs holds Graphviz attributes by name, with plain values which are quoted when converting to DOT.
+type Attrs map[string]string
+
+// Resource is a resource of the configuration, e.g. module.net.azurerm_subnet.this, with the nodes of its
+// instances across every instance of its modules.
+type Resource struct {
+	Address   address.Address // without module and instance keys
+	Instances []*Node
+}
+
+// Node is a box of the diagram. Nodes of resource instances, or of a whole resource which was not expanded,
+// belong to a Resource. Module calls, like a collapsed module, have an address but no resource, while
+// anything else, like a variable or a legend entry, has neither. A stacked node stands for several instances
+// of a resource, its address has no instance key.
+type Node struct {
+	ID       string
+	Address  *address.Address
+	Resource *Resource
+	Label    string   // lines separated by newlines
+	Icon     string   // file name of the icon in the image path, empty for none
+	Group    *Group   // nil for the graph itself
+	Stacked  []string // addresses of the instances of a stacked node, nil for other nodes
+	Attrs    Attrs
+}
+
+// IsInstance checks if the node stands for a resource instance.
+func (n *Node) IsInstance() bool {
+	return n.Resource != nil
+}
+
+// IsStacked checks if the node stands for several instances.
+func (n *Node) IsStacked() bool {
+	return len(n.Stacked) > 0
+}
+
+// IsModuleCall checks if the node stands for a module call.
+func (n *Node) IsModuleCall() bool {
+	return n.Address != nil && n.Address.IsModuleCall()
+}
+
+// Group is a box drawn around nodes and other groups: a module instance, a grouping resource like a subnet,
+// or anything else like a legend. Only groups whose id starts with cluster are drawn by Graphviz.
+type Group struct {
+	ID      string
+	Kind    GroupKind
+	Address *address.Address // module instance or grouping resource, nil for other groups
+	Label   string
+	Parent  *Group // nil for the graph itself
+	Attrs   Attrs
+}
+
+// Depth returns how deep the group is nested, 1 for a group drawn in the graph itself.
+func (g *Group) Depth() int {
+	depth := 0
+	for group := g; group != nil; group = group.Parent {
+		depth++
+	}
+	return depth
+}
+
+// Contains checks if other is the group itself or nested in it at any depth.
+func (g *Group) Contains(other *Group) bool {
+	for group := other; group != nil; group = group.Parent {
+		if group == g {
+			return true
+		}
+	}
+	return false
+}
+
+// Edge points from a node to a node it depends on or otherwise relates to.
+type Edge struct {
+	From   *Node
+	To     *Node
+	Type   string // EdgeDependency for the dependency graph, other types are added by passes
+	Label  string
+	Hidden bool // hidden edges still shape the layout
+	Attrs  Attrs
+}
+
+// Diagram is a graph of nodes, groups and edges.
+type Diagram struct {
+	Name  string
+	Attrs Attrs
+
+	nodes     map[string]*Node
+	groups    map[string]*Group
+	resources map[string]*Resource
+	edges     []*Edge
+	out       map[*Node][]*Edge
+	in        map[*Node][]*Edge
+}
+
+// New returns an empty diagram.
+func New(name string) *Diagram {
+	return &Diagram{
+		Name:      name,
+		Attrs:     make(Attrs),
+		nodes:     make(map[string]*Node),
+		groups:    make(map[string]*Group),
+		resources: make(map[string]*Resource),
+		out:       make(map[*Node][]*Edge),
+		in:        make(map[*Node][]*Edge),
+	}
+}
+
+// AddNode adds a node labeled with label into group, nil for the graph itself. An id which is a resource
+// or module call address is parsed, and the nodes of resources are added to their Resource.
+func (d *Diagram) AddNode(id, label string, group *Group) (*Node, error) {
+	if _, exists := d.nodes[id]; exists {
+		return nil, fmt.Errorf("node %s already exists", id)
+	}
+
+	node := &Node{ID: id, Label: label, Group: group, Attrs: make(Attrs)}
+	if addr, err := address.Parse(id); err == nil {
+		d.setAddress(node, addr)
+	}
+	d.nodes[id] = node
+	return node, nil
+}
+
+// setAddress sets the address of a node, adding it to its Resource unless it is a module call.
+func (d *Diagram) setAddress(node *Node, addr address.Address) {
+	node.Address = &addr
+	if addr.IsModuleCall() {
+		return
+	}
+
+	key := addr.WithoutModuleKeys().WithoutKey()
+	resource, exists := d.resources[key.String()]
+	if !exists {
+		resource = &Resource{Address: key}
+		d.resources[key.String()] = resource
+	}
+	resource.Instances = append(resource.Instances, node)
+	node.Resource = resource
+}
+
+// Node returns the node with the given id, nil if there is none.
+func (d *Diagram) Node(id string) *Node {
+	return d.nodes[id]
+}
+
+// Nodes returns every node, sorted by id.
+func (d *Diagram) Nodes() []*Node {
+	nodes := make([]*Node, 0, len(d.nodes))
+	for _, id := range address.SortedKeys(d.nodes) {
+		nodes = append(nodes, d.nodes[id])
+	}
+	return nodes
+}
+
+// Instances returns the nodes of resource instances, sorted by id.
+func (d *Diagram) Instances() []*Node {
+	var instances []*Node
+	for _, node := range d.Nodes() {
+		if node.IsInstance() {
+			instances = append(instances, node)
+		}
+	}
+	return instances
+}
+
+// RemoveNode removes a node together with its edges.
+func (d *Diagram) RemoveNode(node *Node) {
+	for _, edge := range append(d.EdgesFrom(node), d.EdgesTo(node)...) {
+		d.RemoveEdge(edge)
+	}
+	if resource := node.Resource; resource != nil {
+		resource.Instances = removeNode(resource.Instances, node)
+		if len(resource.Instances) == 0 {
+			delete(d.resources, resource.Address.String())
+		}
+	}
+	delete(d.nodes, node.ID)
+}
+
+// Resource returns the resource with the given address, instance keys are ignored. It returns nil if the
+// diagram has no instance of it.
+func (d *Diagram) Resource(addr address.Address) *Resource {
+	return d.resources[addr.WithoutModuleKeys().WithoutKey().String()]
+}
+
+// Resources returns every resource, sorted by address.
+func (d *Diagram) Resources() []*Resource {
+	resources := make([]*Resource, 0, len(d.resources))
+	for _, key := range address.SortedKeys(d.resources) {
+		resources = append(resources, d.resources[key])
+	}
+	return resources
+}
+
+// AddGroup adds a group of the given kind inside parent, nil for the graph itself.
+func (d *Diagram) AddGroup(id string, kind GroupKind, label string, parent *Group) (*Group, error) {
+	if _, exists := d.groups[id]; exists {
+		return nil, fmt.Errorf("group %s already exists", id)
+	}
+
+	group := &Group{ID: id, Kind: kind, Label: label, Parent: parent, Attrs: make(Attrs)}
+	d.groups[id] = group
+	return group, nil
+}
+
+// Group returns the group with the given id, nil if there is none.
+func (d *Diagram) Group(id string) *Group {
+	return d.groups[id]
+}
+
+// Groups returns every group, sorted by id.
+func (d *Diagram) Groups() []*Group {
+	groups := make([]*Group, 0, len(d.groups))
+	for _, id := range address.SortedKeys(d.groups) {
+		groups = append(groups, d.groups[id])
+	}
+	return groups
+}
+
+// Members returns the nodes drawn directly in group, nil for the graph itself, sorted by id.
+func (d *Diagram) Members(group *Group) []*Node {
+	var members []*Node
+	for _, node := range d.Nodes() {
+		if node.Group == group {
+			members = append(members, node)
+		}
+	}
+	return members
+}
+
+// AddEdge adds an edge of the given type from one node to another.
+func (d *Diagram) AddEdge(from, to *Node, edgeType string) *Edge {
+	edge := &Edge{From: from, To: to, Type: edgeType, Attrs: make(Attrs)}
+	d.edges = append(d.edges, edge)
+	d.out[from] = append(d.out[from], edge)
+	d.in[to] = append(d.in[to], edge)
+	return edge
+}
+
+// CopyEdge adds an edge from one node to another with the type, label and attributes of edge.
+func (d *Diagram) CopyEdge(edge *Edge, from, to *Node) *Edge {
+	copied := d.AddEdge(from, to, edge.Type)
+	copied.Label = edge.Label
+	copied.Hidden = edge.Hidden
+	for key, value := range edge.Attrs {
+		copied.Attrs[key] = value
+	}
+	return copied
+}
+
+// Edges returns every edge in the order they were added.
+func (d *Diagram) Edges() []*Edge {
+	return append([]*Edge(nil), d.edges...)
+}
+
+// EdgesFrom returns the edges starting at node.
+func (d *Diagram) EdgesFrom(node *Node) []*Edge {
+	return append([]*Edge(nil), d.out[node]...)
+}
+
+// EdgesTo returns the edges ending at node.
+func (d *Diagram) EdgesTo(node *Node) []*Edge {
+	return append([]*Edge(nil), d.in[node]...)
+}
+
+// RemoveEdge removes an edge.
+func (d *Diagram) RemoveEdge(edge *Edge) {
+	d.edges = removeEdge(d.edges, edge)
+	d.out[edge.From] = removeEdge(d.out[edge.From], edge)
+	d.in[edge.To] = removeEdge(d.in[edge.To], edge)
+}
+
+// SortGroups returns groups ordered so every parent comes before its children, by id otherwise.
+func SortGroups(groups []*Group) []*Group {
+	sorted := append([]*Group(nil), groups...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if di, dj := sorted[i].Depth(), sorted[j].Depth(); di != dj {
+			return di < dj
+		}
+		return sorted[i].ID < sorted[j].ID
+	})
+	return sorted
+}
+
+func removeNode(nodes []*Node, node *Node) []*Node {
+	for i, n := range nodes {
+		if n == node {
+			return append(nodes[:i:i], nodes[i+1:]...)
+		}
+	}
+	return nodes
+}
+
+func removeEdge(edges []*Edge, edge *Edge) []*Edge {
+	for i, e := range edges {
+		if e == edge {
+			return append(edges[:i:i], edges[i+1:]...)
+		}
+	}
+	return edges
+}
@@ -0,0 +1,126 @@
+package diagram
+
+import (
+	"testing"
+
+	"github.com/awalterschulze/gographviz"
+)
+
+const sourceGraph = `digraph G {
+	rankdir="RL";
+	subgraph "cluster_module.net[0]" {
+		label="module.net[0]";
+		"module.net[0].azurerm_subnet.this[\"web\"]" [ label="module.net[0].azurerm_subnet.this[\"web\"]\naddress_prefixes: 10.0.1.0/24" ];
+	}
+	"module.net[1].azurerm_subnet.this[\"web\"]";
+	"module.app" [ shape="box3d" ];
+	"var.location";
+	"module.net[0].azurerm_subnet.this[\"web\"]" -> "var.location" [ comment="reference", label="location" ];
+	"module.net[1].azurerm_subnet.this[\"web\"]" -> "module.app" [ style=invis ];
+}`
+
+func TestFromGraph(t *testing.T) {
+	d := readDiagram(t)
+
+	subnet := d.Node(`module.net[0].azurerm_subnet.this["web"]`)
+	if subnet == nil || !subnet.IsInstance() {
+		t.Fatalf("subnet is no instance: %+v", subnet)
+	}
+	if subnet.Address.Type != "azurerm_subnet" || subnet.Address.Key != `"web"` || subnet.Address.Module[0].Key != "0" {
+		t.Errorf("unexpected address %+v", subnet.Address)
+	}
+	if subnet.Label != "module.net[0].azurerm_subnet.this[\"web\"]\naddress_prefixes: 10.0.1.0/24" {
+		t.Errorf("unexpected label %q", subnet.Label)
+	}
+	if subnet.Group == nil || subnet.Group.Kind != GroupModule || subnet.Group.Address.ModulePath() != "module.net[0]" {
+		t.Errorf("unexpected group %+v", subnet.Group)
+	}
+
+	// Instances of every module instance belong to one resource
+	resources := d.Resources()
+	if len(resources) != 1 || len(resources[0].Instances) != 2 || resources[0].Address.String() != "module.net.azurerm_subnet.this" {
+		t.Errorf("unexpected resources %+v", resources)
+	}
+
+	if module := d.Node("module.app"); !module.IsModuleCall() || module.IsInstance() || module.Attrs["shape"] != "box3d" {
+		t.Errorf("unexpected module call %+v", module)
+	}
+	if variable := d.Node("var.location"); variable.Address != nil || variable.Label != "var.location" {
+		t.Errorf("unexpected variable %+v", variable)
+	}
+
+	edges := d.Edges()
+	if len(edges) != 2 {
+		t.Fatalf("got %d edges", len(edges))
+	}
+	if edges[0].Type != "reference" || edges[0].Label != "location" || edges[0].Hidden {
+		t.Errorf("unexpected edge %+v", edges[0])
+	}
+	if edges[1].Type != EdgeDependency || !edges[1].Hidden || len(edges[1].Attrs) != 0 {
+		t.Errorf("unexpected edge %+v", edges[1])
+	}
+}
+
+func TestGraphRoundTrip(t *testing.T) {
+	graph, err := readDiagram(t).Graph()
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := FromGraph(graph)
+	if err != nil {
+		t.Fatal(err)
+	}
+	graphAgain, err := again.Graph()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if graph.String() != graphAgain.String() {
+		t.Errorf("graph changed converting it to a diagram and back\nbefore: %s\nafter:  %s", graph, graphAgain)
+	}
+	if label := graph.Nodes.Lookup[`"module.net[0].azurerm_subnet.this[\"web\"]"`].Attrs["label"]; label != `"module.net[0].azurerm_subnet.this[\"web\"]\naddress_prefixes: 10.0.1.0/24"` {
+		t.Errorf("unexpected DOT label %s", label)
+	}
+}
+
+func TestRemoveNode(t *testing.T) {
+	d := readDiagram(t)
+
+	d.RemoveNode(d.Node(`module.net[0].azurerm_subnet.this["web"]`))
+	if len(d.Edges()) != 1 || len(d.EdgesTo(d.Node("var.location"))) != 0 {
+		t.Errorf("edges of the removed node are left: %+v", d.Edges())
+	}
+	if resources := d.Resources(); len(resources) != 1 || len(resources[0].Instances) != 1 {
+		t.Errorf("unexpected resources %+v", resources)
+	}
+
+	d.RemoveNode(d.Node(`module.net[1].azurerm_subnet.this["web"]`))
+	if len(d.Resources()) != 0 || len(d.Edges()) != 0 {
+		t.Error("resource without instances is left")
+	}
+}
+
+func TestGraphRejectsNestedGroups(t *testing.T) {
+	d := New("G")
+	outer, _ := d.AddGroup("cluster_outer", GroupOther, "outer", nil)
+	inner, _ := d.AddGroup("cluster_inner", GroupOther, "inner", outer)
+	outer.Parent = inner
+
+	if _, err := d.Graph(); err == nil {
+		t.Error("expected an error for a group nested in itself")
+	}
+}
+
+// readDiagram reads sourceGraph into a diagram.
+func readDiagram(t *testing.T) *Diagram {
+	t.Helper()
+	graph, err := gographviz.Read([]byte(sourceGraph))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := FromGraph(graph)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
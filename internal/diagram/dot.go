@@ -0,0 +1,215 @@
+package diagram
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/CiucurDaniel/terraview/internal/address"
+	"github.com/awalterschulze/gographviz"
+)
+
+// typeAttribute is the DOT attribute holding the type of an edge, Graphviz ignores comments
+const typeAttribute = "comment"
+
+// FromGraph builds a diagram from the graph of a source. Nodes and groups are identified by their unquoted
+// names, groups named after a module instance or resource address, like cluster_module.net[0], get its kind.
+func FromGraph(graph *gographviz.Graph) (*Diagram, error) {
+	d := New(graph.Name)
+	for key, value := range graph.Attrs {
+		d.Attrs[string(key)] = address.Unquote(value)
+	}
+
+	for _, name := range address.SortedKeys(graph.SubGraphs.SubGraphs) {
+		subgraph := graph.SubGraphs.SubGraphs[name]
+		id := address.Unquote(name)
+		kind := GroupOther
+		var groupAddr *address.Address
+		if inner := strings.TrimPrefix(id, "cluster_"); inner != id {
+			if addr, err := address.Parse(inner); err == nil {
+				groupAddr = &addr
+				kind = GroupResource
+				if addr.IsModuleCall() {
+					kind = GroupModule
+				}
+			}
+		}
+
+		group, err := d.AddGroup(id, kind, text(subgraph.Attrs["label"]), nil)
+		if err != nil {
+			return nil, err
+		}
+		group.Address = groupAddr
+		group.Attrs = attrs(subgraph.Attrs)
+	}
+	for _, name := range address.SortedKeys(graph.SubGraphs.SubGraphs) {
+		d.groups[address.Unquote(name)].Parent = d.groups[parent(graph, name)]
+	}
+
+	for _, node := range graph.Nodes.Sorted() {
+		id := address.Unquote(node.Name)
+		label := id
+		if value, ok := node.Attrs["label"]; ok {
+			label = text(value)
+		}
+
+		n, err := d.AddNode(id, label, d.groups[parent(graph, node.Name)])
+		if err != nil {
+			return nil, err
+		}
+		// Graphs of terraform before 1.7 name nodes like "[root] azurerm_subnet.this (expand)", labeled with the address
+		if n.Address == nil {
+			if addr, err := address.Parse(label); err == nil && !addr.IsModuleCall() {
+				d.setAddress(n, addr)
+			}
+		}
+		n.Icon = address.Unquote(node.Attrs["image"])
+		n.Attrs = attrs(node.Attrs)
+	}
+
+	for _, edge := range graph.Edges.Edges {
+		from, to := d.nodes[address.Unquote(edge.Src)], d.nodes[address.Unquote(edge.Dst)]
+		if from == nil || to == nil {
+			return nil, fmt.Errorf("edge %s -> %s connects an unknown node", edge.Src, edge.Dst)
+		}
+
+		edgeType := address.Unquote(edge.Attrs[typeAttribute])
+		if edgeType == "" {
+			edgeType = EdgeDependency
+		}
+		e := d.AddEdge(from, to, edgeType)
+		e.Label = text(edge.Attrs["label"])
+		e.Attrs = attrs(edge.Attrs)
+		delete(e.Attrs, typeAttribute)
+		if e.Attrs["style"] == "invis" {
+			e.Hidden = true
+			delete(e.Attrs, "style")
+		}
+	}
+
+	return d, nil
+}
+
+// Graph converts the diagram into a Graphviz graph. Names are quoted, labels turned into DOT strings and the
+// type of edges other than dependencies is kept in their comment.
+func (d *Diagram) Graph() (*gographviz.Graph, error) {
+	graph := gographviz.NewGraph()
+	name := d.Name
+	if name == "" {
+		name = "G"
+	}
+	if err := graph.SetName(name); err != nil {
+		return nil, err
+	}
+	if err := graph.SetDir(true); err != nil {
+		return nil, err
+	}
+	for _, key := range address.SortedKeys(d.Attrs) {
+		if err := graph.AddAttr(name, key, address.Quote(d.Attrs[key])); err != nil {
+			return nil, err
+		}
+	}
+
+	groups := d.Groups()
+	for _, group := range groups {
+		seen := make(map[*Group]bool)
+		for g := group; g != nil; g = g.Parent {
+			if seen[g] {
+				return nil, fmt.Errorf("group %s is nested in itself", group.ID)
+			}
+			seen[g] = true
+		}
+	}
+	for _, group := range SortGroups(groups) {
+		groupAttrs := quoted(group.Attrs)
+		if group.Label != "" {
+			groupAttrs["label"] = dotLabel(group.Label)
+		}
+		if err := graph.AddSubGraph(parentName(name, group.Parent), address.Quote(group.ID), groupAttrs); err != nil {
+			return nil, fmt.Errorf("group %s: %v", group.ID, err)
+		}
+	}
+
+	for _, node := range d.Nodes() {
+		nodeAttrs := quoted(node.Attrs)
+		nodeAttrs["label"] = dotLabel(node.Label)
+		if node.Icon != "" {
+			nodeAttrs["image"] = address.Quote(node.Icon)
+		}
+		if err := graph.AddNode(parentName(name, node.Group), address.Quote(node.ID), nodeAttrs); err != nil {
+			return nil, fmt.Errorf("node %s: %v", node.ID, err)
+		}
+	}
+
+	for _, edge := range d.edges {
+		edgeAttrs := quoted(edge.Attrs)
+		if edge.Label != "" {
+			edgeAttrs["label"] = dotLabel(edge.Label)
+		}
+		if edge.Hidden {
+			edgeAttrs["style"] = "invis"
+		}
+		if edge.Type != "" && edge.Type != EdgeDependency {
+			edgeAttrs[typeAttribute] = address.Quote(edge.Type)
+		}
+		if err := graph.AddEdge(address.Quote(edge.From.ID), address.Quote(edge.To.ID), true, edgeAttrs); err != nil {
+			return nil, fmt.Errorf("edge %s -> %s: %v", edge.From.ID, edge.To.ID, err)
+		}
+	}
+
+	return graph, nil
+}
+
+// parentName returns the DOT name of a group, or of the graph itself for nil.
+func parentName(graphName string, group *Group) string {
+	if group == nil {
+		return graphName
+	}
+	return address.Quote(group.ID)
+}
+
+// parent returns the id of the group something is drawn in, empty for the graph itself. Something listed in
+// several subgraphs belongs to the first one by name.
+func parent(graph *gographviz.Graph, name string) string {
+	var parents []string
+	for p := range graph.Relations.ChildToParents[name] {
+		if p != graph.Name && p != name {
+			parents = append(parents, p)
+		}
+	}
+	if len(parents) == 0 {
+		return ""
+	}
+	sort.Strings(parents)
+	return address.Unquote(parents[0])
+}
+
+// attrs returns DOT attributes without quotes, leaving out the ones held in fields.
+func attrs(dotAttrs gographviz.Attrs) Attrs {
+	result := make(Attrs)
+	for key, value := range dotAttrs {
+		if key != "label" && key != "image" {
+			result[string(key)] = address.Unquote(value)
+		}
+	}
+	return result
+}
+
+// quoted returns attributes as quoted DOT values.
+func quoted(attrs Attrs) map[string]string {
+	result := make(map[string]string, len(attrs)+2)
+	for key, value := range attrs {
+		result[key] = address.Quote(value)
+	}
+	return result
+}
+
+// text turns a DOT label into text, line breaks become newlines.
+func text(value string) string {
+	return strings.ReplaceAll(address.Unquote(value), `\n`, "\n")
+}
+
+// dotLabel is the inverse of text.
+func dotLabel(text string) string {
+	return address.Quote(strings.ReplaceAll(text, "\n", `\n`))
+}
@@ -0,0 +1,188 @@
+package drift
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/CiucurDaniel/terraview/internal/address"
+	"github.com/CiucurDaniel/terraview/internal/tfconfigreader"
+	"github.com/CiucurDaniel/terraview/internal/tfstatereader"
+)
+
+// Report lists the differences found between the configuration and the state.
+type Report struct {
+	NotApplied    []string      // declared in the configuration but never applied
+	NotInCode     []string      // present in the state but removed from the configuration
+	KeyMismatches []KeyMismatch // instance keys which differ from what count or for_each declares
+}
+
+// KeyMismatch describes a resource whose instances in state do not match its count or for_each.
+type KeyMismatch struct {
+	Address  string
+	Expected []string
+	Actual   []string
+	Reason   string
+}
+
+// Compare cross-checks the resources declared in the configuration against the instances in the state.
+func Compare(root *tfconfigreader.Module, state *tfstatereader.RawState) *Report {
+	declarations, opaque := tfconfigreader.Declarations(root)
+
+	// Collect the instance keys recorded in state per configuration address
+	stateKeys := make(map[string][]string)
+	for _, resource := range state.Resources {
+		config := ConfigAddress(resource.Address())
+		if insideModule(config, opaque) {
+			continue
+		}
+		if _, exists := stateKeys[config]; !exists {
+			stateKeys[config] = []string{}
+		}
+		for _, instance := range resource.Instances {
+			stateKeys[config] = append(stateKeys[config], string(instance.IndexKey))
+		}
+	}
+
+	report := &Report{}
+	declared := make(map[string]bool)
+	for _, declaration := range declarations {
+		declared[declaration.Address] = true
+
+		keys, applied := stateKeys[declaration.Address]
+		if !applied || len(keys) == 0 {
+			report.NotApplied = append(report.NotApplied, declaration.Address)
+			continue
+		}
+
+		if mismatch := compareKeys(declaration, keys); mismatch != nil {
+			report.KeyMismatches = append(report.KeyMismatches, *mismatch)
+		}
+	}
+
+	for _, resource := range state.Resources {
+		config := ConfigAddress(resource.Address())
+		if !declared[config] && !insideModule(config, opaque) {
+			report.NotInCode = append(report.NotInCode, resource.Address())
+		}
+	}
+	sort.Strings(report.NotInCode)
+
+	return report
+}
+
+// compareKeys checks the keys found in state against the count or for_each of the declaration.
+func compareKeys(declaration tfconfigreader.Declaration, actual []string) *KeyMismatch {
+	actual = uniqueSorted(actual)
+	mismatch := &KeyMismatch{Address: declaration.Address, Actual: actual}
+
+	if declaration.Expansion == nil {
+		if len(actual) == 1 && actual[0] == "" {
+			return nil
+		}
+		mismatch.Reason = "configuration has no count or for_each but state has keyed instances"
+		return mismatch
+	}
+
+	for _, key := range actual {
+		switch {
+		case key == "":
+			mismatch.Reason = fmt.Sprintf("configuration uses %s but state has an instance without key", declaration.Expansion.Kind)
+			return mismatch
+		case declaration.Expansion.Kind == "count" && strings.HasPrefix(key, `"`):
+			mismatch.Reason = "configuration uses count but state has for_each keys"
+			return mismatch
+		case declaration.Expansion.Kind == "for_each" && !strings.HasPrefix(key, `"`):
+			mismatch.Reason = "configuration uses for_each but state has count indexes"
+			return mismatch
+		}
+	}
+
+	expected, known := declaration.ExpectedKeys()
+	if !known || strings.Join(expected, ",") == strings.Join(actual, ",") {
+		return nil
+	}
+	mismatch.Expected = expected
+	mismatch.Reason = fmt.Sprintf("%s declares different keys than the ones in state", declaration.Expansion.Kind)
+	return mismatch
+}
+
+// ConfigAddress strips module instance keys so a state address can be compared with the configuration.
+func ConfigAddress(resource string) string {
+	addr, err := address.Parse(resource)
+	if err != nil {
+		return resource
+	}
+	return addr.WithoutModuleKeys().String()
+}
+
+// insideModule checks if the address belongs to one of the module prefixes.
+func insideModule(resource string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(resource, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func uniqueSorted(values []string) []string {
+	seen := make(map[string]bool)
+	var result []string
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Empty checks if no differences were found.
+func (r *Report) Empty() bool {
+	return len(r.NotApplied) == 0 && len(r.NotInCode) == 0 && len(r.KeyMismatches) == 0
+}
+
+// Print writes a human readable report.
+func (r *Report) Print(w io.Writer) {
+	if r.Empty() {
+		fmt.Fprintln(w, "INFO: No drift found between configuration and state")
+		return
+	}
+
+	if len(r.NotApplied) > 0 {
+		fmt.Fprintln(w, "Declared but never applied:")
+		for _, resource := range r.NotApplied {
+			fmt.Fprintf(w, "- %s\n", resource)
+		}
+	}
+	if len(r.NotInCode) > 0 {
+		fmt.Fprintln(w, "In state but removed from code:")
+		for _, resource := range r.NotInCode {
+			fmt.Fprintf(w, "- %s\n", resource)
+		}
+	}
+	if len(r.KeyMismatches) > 0 {
+		fmt.Fprintln(w, "Instance keys differ:")
+		for _, mismatch := range r.KeyMismatches {
+			fmt.Fprintf(w, "- %s: %s (state: %s", mismatch.Address, mismatch.Reason, formatKeys(mismatch.Actual))
+			if mismatch.Expected != nil {
+				fmt.Fprintf(w, ", configuration: %s", formatKeys(mismatch.Expected))
+			}
+			fmt.Fprintln(w, ")")
+		}
+	}
+}
+
+func formatKeys(keys []string) string {
+	var formatted []string
+	for _, key := range keys {
+		if key == "" {
+			key = "no key"
+		}
+		formatted = append(formatted, key)
+	}
+	return "[" + strings.Join(formatted, ", ") + "]"
+}
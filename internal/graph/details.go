@@ -0,0 +1,51 @@
+package graph
+
+import (
+	"github.com/CiucurDaniel/terraview/internal/address"
+	"github.com/CiucurDaniel/terraview/internal/diagram"
+	"github.com/CiucurDaniel/terraview/internal/icons"
+	"github.com/CiucurDaniel/terraview/internal/model"
+	"github.com/CiucurDaniel/terraview/internal/tfstatereader"
+)
+
+// Details describes every resource node of the diagram for the interactive output: its address, the provider
+// and dependencies recorded in the state and all of its attributes, masked like in the labels.
+// Without a handler only the address and the provider told by the resource type are known.
+// Stacked nodes have the attributes of every instance, keyed by the instance address, and the dependencies of all.
+// Details are keyed by the quoted node name, like the nodes of the graph the diagram converts to.
+func Details(d *diagram.Diagram, handler *tfstatereader.TFStateHandler) map[string]model.Details {
+	details := make(map[string]model.Details)
+	for _, node := range d.Instances() {
+		resource := node.ID
+		nodeDetails := model.Details{
+			Address:  resource,
+			Provider: icons.Provider(node.Address.Type),
+		}
+		if handler != nil && node.IsStacked() {
+			nodeDetails.Attributes = make(map[string]interface{})
+			for _, instance := range node.Stacked {
+				if res, raw, ok := handler.FindInstance(instance); ok {
+					nodeDetails.Provider = res.Provider
+					for _, dependency := range raw.Dependencies {
+						if !address.Contains(nodeDetails.Dependencies, dependency) {
+							nodeDetails.Dependencies = append(nodeDetails.Dependencies, dependency)
+						}
+					}
+				}
+				if attributes, err := handler.GetAttributes(instance); err == nil {
+					nodeDetails.Attributes[instance] = attributes
+				}
+			}
+		} else if handler != nil {
+			if res, instance, ok := handler.FindInstance(resource); ok {
+				nodeDetails.Provider = res.Provider
+				nodeDetails.Dependencies = instance.Dependencies
+			}
+			if attributes, err := handler.GetAttributes(resource); err == nil {
+				nodeDetails.Attributes = attributes
+			}
+		}
+		details[address.Quote(node.ID)] = nodeDetails
+	}
+	return details
+}
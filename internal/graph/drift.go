@@ -0,0 +1,83 @@
+package graph
+
+import (
+	"github.com/CiucurDaniel/terraview/internal/address"
+	"github.com/CiucurDaniel/terraview/internal/diagram"
+	"github.com/CiucurDaniel/terraview/internal/drift"
+)
+
+// Drift categories shown in the legend.
+const (
+	driftNotApplied  = "not applied"
+	driftNotInCode   = "not in code"
+	driftKeyMismatch = "key mismatch"
+)
+
+// driftStyles maps every drift category to a distinct style.
+var driftStyles = map[string]nodeStyle{
+	driftNotApplied:  {Style: "filled,dashed", FillColor: "#ddf4ff", Color: "#0969da", FontColor: "#0969da"},
+	driftNotInCode:   {Style: "filled,dashed", FillColor: "#ffd7d5", Color: "#cf222e", FontColor: "#cf222e"},
+	driftKeyMismatch: {Style: "filled,bold", FillColor: "#fff1e5", Color: "#bc4c00", FontColor: "#bc4c00"},
+}
+
+// ApplyDrift highlights the resources listed in the drift report and adds a legend.
+// Resources which only exist in state are added as ghost nodes.
+// It must run after PrepareGraphForPrinting as nodes are matched by their address.
+func ApplyDrift(d *diagram.Diagram, report *drift.Report) {
+	used := make(map[string]bool)
+
+	for _, resource := range report.NotApplied {
+		for _, node := range findResourceNodes(d, resource) {
+			markDrift(node, driftNotApplied, "declared but never applied")
+			used[driftNotApplied] = true
+		}
+	}
+
+	for _, resource := range report.NotInCode {
+		nodes := findResourceNodes(d, resource)
+		if len(nodes) == 0 {
+			nodes = []*diagram.Node{addGhostNode(d, resource)}
+		}
+		for _, node := range nodes {
+			markDrift(node, driftNotInCode, "in state but removed from code")
+			used[driftNotInCode] = true
+		}
+	}
+
+	for _, mismatch := range report.KeyMismatches {
+		for _, node := range findResourceNodes(d, mismatch.Address) {
+			markDrift(node, driftKeyMismatch, mismatch.Reason)
+			used[driftKeyMismatch] = true
+		}
+	}
+
+	var legend []string
+	for _, category := range []string{driftNotApplied, driftNotInCode, driftKeyMismatch} {
+		if used[category] {
+			legend = append(legend, category)
+		}
+	}
+	addLegend(d, "Drift", legend, driftStyles)
+}
+
+// findResourceNodes returns the nodes of a resource, either a single node or one per expanded instance.
+// The resource may be given without module keys, e.g. module.net.azurerm_subnet.this, and the graph may not be expanded.
+func findResourceNodes(d *diagram.Diagram, resource string) []*diagram.Node {
+	target, err := address.Parse(resource)
+	if err != nil {
+		return nil
+	}
+
+	var nodes []*diagram.Node
+	for _, node := range d.Nodes() {
+		if node.Address != nil && (target.Covers(*node.Address) || node.Address.Covers(target)) {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+func markDrift(node *diagram.Node, category, reason string) {
+	applyNodeStyle(node, driftStyles[category])
+	node.Attrs["tooltip"] = reason
+}
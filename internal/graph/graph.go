@@ -3,15 +3,17 @@ package graph
 import (
 	"bytes"
 	"fmt"
-	"io"
 	"log"
-	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 
+	"github.com/CiucurDaniel/terraview/internal/address"
 	"github.com/CiucurDaniel/terraview/internal/config"
+	"github.com/CiucurDaniel/terraview/internal/diagram"
+	"github.com/CiucurDaniel/terraview/internal/icons"
+	"github.com/CiucurDaniel/terraview/internal/tfconfigreader"
 	"github.com/CiucurDaniel/terraview/internal/tfstatereader"
 	"github.com/awalterschulze/gographviz"
 )
@@ -21,11 +23,8 @@ const (
 	GRAPH_LABEL_LOCATION = "b"
 )
 
-// KnownProviders is a constant array containing known provider prefixes
-var KnownProviders = []string{"azurerm", "aws", "gcp"}
-
 // ObtainGraph invokes "terraform graph" command in the specified directory
-// and returns the graph data as a string.
+// and returns the parsed graph.
 func ObtainGraph(dirPath string) (*gographviz.Graph, error) {
 	// Get the absolute path of the directory
 	absDirPath, err := filepath.Abs(dirPath)
@@ -53,59 +52,51 @@ func ObtainGraph(dirPath string) (*gographviz.Graph, error) {
 		// WARNING: this will always be thrown if user didn't run terraform init prior to invoking our code
 	}
 
-	// Get the graph data as a string
-	graphData := out.String()
+	// Parse the output into a graph
+	return ParseGraph(out.Bytes())
+}
 
-	// Parse string into AST
-	graphAst, err := gographviz.ParseString(graphData)
+// ObtainGraphFromConfig parses the Terraform files in the specified directory
+// and builds the graph without invoking the terraform binary.
+// Unlike ObtainGraph it does not require "terraform init" to have been run.
+func ObtainGraphFromConfig(dirPath string) (*gographviz.Graph, error) {
+	graph, err := tfconfigreader.BuildGraph(dirPath)
 	if err != nil {
-		return nil, fmt.Errorf("error parsing Terraform graph data: %v", err)
+		return nil, fmt.Errorf("error building graph from Terraform configuration: %v", err)
 	}
 
-	// Create a new graph object
-	graph := gographviz.NewGraph()
+	return graph, nil
+}
 
-	// Analyze and populate the graph object
-	err = gographviz.Analyse(graphAst, graph)
+// PrepareGraphForPrinting is a facade function for preparing the diagram for printing.
+// It obtains the graph data from the source and runs the pipeline configured in cfg, DefaultPipeline without
+// a pipeline section, on the typed diagram. The diagram is converted to a Graphviz graph with Graph once the
+// caller added its own passes. dump, if not nil, is called after every pass.
+// The handler may be nil when no state is available, in which case state based passes are skipped.
+func PrepareGraphForPrinting(source GraphSource, cfg *config.Config, handler *tfstatereader.TFStateHandler, assetsDir string, dump DumpFunc) (*diagram.Diagram, error) {
+	steps, err := Pipeline(cfg)
 	if err != nil {
-		return nil, fmt.Errorf("error analyzing Terraform graph data: %v", err)
+		return nil, err
 	}
 
-	// Return the parsed graph
-	return graph, nil
-}
-
-// PrepareGraphForPrinting is a facade function for preparing the graph for printing.
-// It obtains the graph data, adds image labels to nodes, and returns the modified graph.
-func PrepareGraphForPrinting(dirPath string, cfg *config.Config, handler *tfstatereader.TFStateHandler, assetsDir string) (*gographviz.Graph, error) {
 	// Obtain the graph
-	graph, err := ObtainGraph(dirPath)
+	graph, err := source.Graph()
 	if err != nil {
 		return nil, fmt.Errorf("failed to obtain graph data: %v", err)
 	}
-
-	SetGraphAttrs(graph)
-	ExpandNodeCreatedWithList(graph, handler)
-	CleanUpEdges(graph)
-	BetaCreateSubgraphsForGroupingNodes(graph)
-	AddImageLabel(graph, assetsDir)
-	PositionNodeLabelTo(graph, NODE_LABEL_LOCATION)
-	PositionGraphLabelTo(graph, GRAPH_LABEL_LOCATION)
-	SetGraphFontsize(graph, 28.0, 22.0)
-	AddMarginToNodes(graph, 1.5)
-	SetSubgraphMargins(graph, CalculateMaxDepth(graph), 10)
-	HideEdgesBetweenSubgraphs(graph)
-
-	err = AddImportantAttributesToLabels(graph, cfg, handler)
+	d, err := diagram.FromGraph(graph)
 	if err != nil {
-		return nil, fmt.Errorf("failed to add important attributes to labels: %v", err)
+		return nil, fmt.Errorf("failed to read graph data: %v", err)
 	}
 
-	CopyLabelsFromGroupingNodesToSubgraph(graph)
-	RemoveResourceTypeFromLabels(graph)
-	HideLabelsFromGroupingNodes(graph)
+	cfg.ApplyProviderPacks(DetectProviders(d, handler))
 
-	return graph, nil
+	ctx := PassContext{Config: cfg, Handler: handler, Source: source, AssetsDir: assetsDir}
+	if err := RunPipeline(d, steps, ctx, dump); err != nil {
+		return nil, err
+	}
+
+	return d, nil
 }
 
 // SetGraphAttrs func will set:
@@ -113,557 +104,396 @@ func PrepareGraphForPrinting(dirPath string, cfg *config.Config, handler *tfstat
 // - newrank = true
 // - rankdir = "TD
 // - (optional) call SetGraphGlobalImagePath
-func SetGraphAttrs(graph *gographviz.Graph) {
-	graph.Attrs["compound"] = `"true"`
-	graph.Attrs["rankdir"] = `"BT"`
-	graph.Attrs["newrank"] = `"true"`
-	graph.Attrs["nodesep"] = `"1.5"`
-	graph.Attrs["ranksep"] = `"1.5"`
-	graph.Attrs["pad"] = `"0.9"`
+func SetGraphAttrs(d *diagram.Diagram) {
+	d.Attrs["compound"] = "true"
+	d.Attrs["rankdir"] = "BT"
+	d.Attrs["newrank"] = "true"
+	d.Attrs["nodesep"] = "1.5"
+	d.Attrs["ranksep"] = "1.5"
+	d.Attrs["pad"] = "0.9"
 
 	// TODO: For each subgraph set labelloc="b";
 }
 
-// IsResourceNode checks if the label represents a resource node based on the known provider prefixes.
-// It returns true if the label starts with any of the known prefixes, otherwise false.
-// FIXME: Might not be needed in current Terrraform versions
+// IsResourceNode checks if the label represents a resource node: the first line of the label must be a
+// resource or data source address, e.g. kubernetes_namespace.app or module.net.azurerm_subnet.this["web"].
+// Resources of any provider are recognised, variables, outputs, providers and module calls are not.
 func IsResourceNode(label string) bool {
-	for _, provider := range KnownProviders {
-		if strings.HasPrefix(label, provider+"_") {
-			return true
+	addr, err := address.Parse(strings.SplitN(label, "\n", 2)[0])
+	return err == nil && !addr.IsModuleCall()
+}
+
+// DetectProviders returns the providers of the resources in the diagram, by the prefix of their type,
+// together with the providers recorded in the state when a handler is given.
+func DetectProviders(d *diagram.Diagram, handler *tfstatereader.TFStateHandler) []string {
+	var providers []string
+	if handler != nil {
+		providers = handler.Providers()
+	}
+	for _, node := range d.Instances() {
+		provider := icons.Provider(node.Address.Type)
+		if !address.Contains(providers, provider) {
+			providers = append(providers, provider)
 		}
 	}
-	return false
+	return providers
 }
 
-func AddImageLabel(graph *gographviz.Graph, tempDir string) {
-	// Create a map to track unique resources and their local image paths
-	imageMap := make(map[string]string)
-
+// AddImageLabel sets the icon of every resource node to the one the icon pack has for its type.
+// Icons are looked up in parallel before being written to tempDir. Nodes whose type has no icon keep their shape.
+func AddImageLabel(d *diagram.Diagram, tempDir string, pack *icons.Pack) {
 	// Set the global image path attribute for the graph
-	graph.Attrs.Add("imagepath", fmt.Sprintf(`"%s"`, tempDir))
-
-	for _, node := range graph.Nodes.Nodes {
-		// Get the current label of the node
-		label := node.Attrs["label"]
-
-		// Remove existing quotes, if any
-		label = strings.Trim(label, `"`)
+	d.Attrs["imagepath"] = tempDir
 
-		// Check if the node represents a resource
-		if IsResourceNode(label) {
-			// Split the label by underscore to extract the relevant part
-			parts := strings.Split(label, ".")
+	// Collect the resource types, looking each type up once
+	var resourceTypes []string
+	for _, node := range d.Instances() {
+		if !address.Contains(resourceTypes, node.Address.Type) {
+			resourceTypes = append(resourceTypes, node.Address.Type)
+		}
+	}
 
-			// If the label is empty or doesn't contain a dot, skip the node
-			if len(parts) < 2 {
-				continue
-			}
+	available := make(map[string]bool)
+	for resourceType, data := range pack.Resolve(resourceTypes) {
+		if err := os.WriteFile(filepath.Join(tempDir, resourceType+".png"), data, 0644); err != nil {
+			fmt.Fprintln(os.Stderr, "ERROR: Could not write icon:", err)
+			continue
+		}
+		available[resourceType] = true
+	}
 
-			// Construct the image name
-			imageName := parts[0] + ".png"
-
-			// Check if the image has already been downloaded
-			localImagePath, exists := imageMap[imageName]
-			if !exists {
-				// Construct the image URL and local path
-				imageURL := fmt.Sprintf("https://raw.githubusercontent.com/CiucurDaniel/terraview-assets/main/icons/azurerm/%s", imageName)
-				localImagePath = filepath.Join(tempDir, imageName)
-
-				// Download the image
-				err := downloadImage(imageURL, localImagePath)
-				if err != nil {
-					fmt.Println("Error downloading image:", err)
-					continue
-				}
-
-				// Store the local image path in the map
-				imageMap[imageName] = imageName // Store only the image name
-			}
+	for _, node := range d.Instances() {
+		if !available[node.Address.Type] {
+			continue
+		}
 
-			// Set the image label attribute
-			node.Attrs["image"] = fmt.Sprintf(`"%s"`, imageName)
+		// Set the image label attribute
+		node.Icon = node.Address.Type + ".png"
 
-			// Set shape to none so the icon is not surrounded by a box
-			node.Attrs["shape"] = `"none"`
-		}
+		// Set shape to none so the icon is not surrounded by a box
+		node.Attrs["shape"] = "none"
 	}
 }
 
-// PositionNodeLabelTo sets the labelloc attribute of every node in the graph to the specified position.
+// PositionNodeLabelTo sets the labelloc attribute of every node in the diagram to the specified position.
 // Valid positions are "t" (top), "c" (center), and "b" (bottom).
-func PositionNodeLabelTo(graph *gographviz.Graph, position string) {
+func PositionNodeLabelTo(d *diagram.Diagram, position string) {
 	// Check if the specified position is valid
 	if position != "t" && position != "c" && position != "b" {
 		return // If not valid, do nothing
 	}
 
-	// Iterate over every node in the graph
-	for _, node := range graph.Nodes.Nodes {
+	// Iterate over every node in the diagram
+	for _, node := range d.Nodes() {
 		// Set the labelloc attribute of the node to the specified position
-		node.Attrs["labelloc"] = fmt.Sprintf(`"%s"`, position)
+		node.Attrs["labelloc"] = position
 	}
 }
 
-// PositionGraphLabelTo sets the labelloc attribute of every graph/subgraph in the graph to the specified position.
+// PositionGraphLabelTo sets the labelloc attribute of every group in the diagram to the specified position.
 // Valid positions are "t" (top), "c" (center), and "b" (bottom).
-func PositionGraphLabelTo(graph *gographviz.Graph, position string) {
+func PositionGraphLabelTo(d *diagram.Diagram, position string) {
 	// Check if the specified position is valid
 	if position != "t" && position != "c" && position != "b" {
 		return // If not valid, do nothing
 	}
 
-	// Iterate over every node in the graph
-	for _, graph := range graph.SubGraphs.SubGraphs {
-		// Set the labelloc attribute of the node to the specified position
-		graph.Attrs["labelloc"] = fmt.Sprintf(`"%s"`, position)
+	// Iterate over every group in the diagram
+	for _, group := range d.Groups() {
+		// Set the labelloc attribute of the group to the specified position
+		group.Attrs["labelloc"] = position
 	}
 }
 
-// AddMarginToNodes sets the margin attribute of every node in the graph to the specified value.
-func AddMarginToNodes(graph *gographviz.Graph, value float32) {
-	// Iterate over every node in the graph
-	for _, node := range graph.Nodes.Nodes {
-		// Set the labelloc attribute of the node to the specified position
-		node.Attrs["margin"] = fmt.Sprintf(`"%.2f"`, value)
+// AddMarginToNodes sets the margin attribute of every node in the diagram to the specified value.
+func AddMarginToNodes(d *diagram.Diagram, value float32) {
+	// Iterate over every node in the diagram
+	for _, node := range d.Nodes() {
+		node.Attrs["margin"] = fmt.Sprintf("%.2f", value)
 	}
 }
 
-// SetGraphFontsize sets the fontsize attribute of every node in the graph to the specified value.
-func SetGraphFontsize(graph *gographviz.Graph, graphValue, nodeValue float32) {
-	// Iterate over every node in the graph
-	for _, node := range graph.Nodes.Nodes {
-		node.Attrs["fontsize"] = fmt.Sprintf(`"%.1f"`, nodeValue)
+// SetGraphFontsize sets the fontsize attribute of every node and group in the diagram to the specified values.
+func SetGraphFontsize(d *diagram.Diagram, graphValue, nodeValue float32) {
+	// Iterate over every node in the diagram
+	for _, node := range d.Nodes() {
+		node.Attrs["fontsize"] = fmt.Sprintf("%.1f", nodeValue)
 	}
 
-	// Iterate over every graph/subgraph in the graph
-	for _, graph := range graph.SubGraphs.SubGraphs {
-		graph.Attrs["fontsize"] = fmt.Sprintf(`"%.1f"`, graphValue)
+	// Iterate over every group in the diagram
+	for _, group := range d.Groups() {
+		group.Attrs["fontsize"] = fmt.Sprintf("%.1f", graphValue)
 	}
 }
 
-func HideLabelsFromGroupingNodes(graph *gographviz.Graph) {
-	for _, node := range graph.Nodes.Nodes {
-		if isGroupingResource(node.Name) {
-			node.Attrs.Add("label", `""`)
+func HideLabelsFromGroupingNodes(d *diagram.Diagram) {
+	for _, node := range d.Nodes() {
+		if isGroupingResource(node) {
+			node.Label = ""
 		}
 	}
 }
 
-func CopyLabelsFromGroupingNodesToSubgraph(graph *gographviz.Graph) {
-	for _, subgraph := range graph.SubGraphs.SubGraphs {
-		cleanSubgraphName := strings.Replace(subgraph.Name, `"cluster_`, `"`, 1)
-		if isGroupingResource(cleanSubgraphName) {
-			node, exists := graph.Nodes.Lookup[cleanSubgraphName]
-			if exists {
-				// Move the label from the node to the subgraph
-				subgraph.Attrs.Add("label", node.Attrs["label"])
-			}
+func CopyLabelsFromGroupingNodesToSubgraph(d *diagram.Diagram) {
+	for _, group := range d.Groups() {
+		if group.Kind != diagram.GroupResource {
+			continue
+		}
+		node := d.Node(strings.TrimPrefix(group.ID, "cluster_"))
+		if node != nil && isGroupingResource(node) {
+			// Move the label from the node to the group
+			group.Label = node.Label
 		}
 	}
 }
 
-func RemoveResourceTypeFromLabels(graph *gographviz.Graph) {
-	for _, node := range graph.Nodes.Nodes {
-		label := node.Attrs["label"]
-		label = strings.Trim(label, `"`)
-
-		if IsResourceNode(label) {
-			// Split the label by newline to get the first part
-			labelParts := strings.SplitN(label, "\\n", 2)
-			resourcePart := labelParts[0]
-
-			// Split the resource part by dot to remove the resource type prefix
-			resourceParts := strings.Split(resourcePart, ".")
-			if len(resourceParts) < 2 {
-				continue
-			}
-
-			// Cut any potential indexes
-			newLabel := strings.Split(resourceParts[1], "[")[0]
-
-			// Add the remaining parts back if they exist
-			if len(labelParts) > 1 {
-				newLabel = fmt.Sprintf("%s\n%s", newLabel, labelParts[1])
-			}
-
-			node.Attrs["label"] = fmt.Sprintf(`"%s"`, newLabel)
+func RemoveResourceTypeFromLabels(d *diagram.Diagram) {
+	for _, node := range d.Nodes() {
+		if newLabel, ok := removeResourceType(node.Label); ok {
+			node.Label = newLabel
 		}
 	}
 
-	for _, graph := range graph.SubGraphs.SubGraphs {
-		label := graph.Attrs["label"]
-		label = strings.Trim(label, `"`)
-
-		if IsResourceNode(label) {
-			// Split the label by newline to get the first part
-			labelParts := strings.SplitN(label, "\\n", 2)
-			resourcePart := labelParts[0]
-
-			// Split the resource part by dot to remove the resource type prefix
-			resourceParts := strings.Split(resourcePart, ".")
-			if len(resourceParts) < 2 {
-				continue
-			}
+	for _, group := range d.Groups() {
+		if newLabel, ok := removeResourceType(group.Label); ok {
+			group.Label = newLabel
+		}
+	}
+}
 
-			// Cut any potential indexes
-			newLabel := strings.Split(resourceParts[1], "[")[0]
+// removeResourceType replaces the address in the first line of a label with the bare resource name,
+// cutting the module path, resource type and any index.
+func removeResourceType(label string) (string, bool) {
+	// Split the label by newline to get the first part
+	labelParts := strings.SplitN(label, "\n", 2)
+	addr, err := address.Parse(labelParts[0])
+	if err != nil || addr.IsModuleCall() {
+		return "", false
+	}
 
-			// Add the remaining parts back if they exist
-			if len(labelParts) > 1 {
-				newLabel = fmt.Sprintf("%s\n%s", newLabel, labelParts[1])
-			}
+	newLabel := addr.Name
 
-			graph.Attrs["label"] = fmt.Sprintf(`"%s"`, newLabel)
-		}
+	// Add the remaining parts back if they exist
+	if len(labelParts) > 1 {
+		newLabel += "\n" + labelParts[1]
 	}
+
+	return newLabel, true
 }
 
-// CalculateMaxDepth calculates the maximum depth of nested subgraphs in the graph.
-func CalculateMaxDepth(graph *gographviz.Graph) int {
+// CalculateMaxDepth calculates the maximum depth of nested groups in the diagram, counting the nodes drawn in them.
+func CalculateMaxDepth(d *diagram.Diagram) int {
 	var maxDepth int
-	var dfs func(node string, depth int)
-	dfs = func(node string, depth int) {
-		if depth > maxDepth {
+	for _, group := range d.Groups() {
+		if depth := group.Depth(); depth > maxDepth {
 			maxDepth = depth
 		}
-		for child := range graph.Relations.ParentToChildren[node] {
-			dfs(child, depth+1)
-		}
 	}
-	for _, subgraph := range graph.SubGraphs.SubGraphs {
-		dfs(subgraph.Name, 1)
+	for _, node := range d.Nodes() {
+		if node.Group == nil {
+			continue
+		}
+		if depth := node.Group.Depth() + 1; depth > maxDepth {
+			maxDepth = depth
+		}
 	}
 	return maxDepth
 }
 
-// SetSubgraphMargins sets the margin attribute for each subgraph based on its depth.
-func SetSubgraphMargins(graph *gographviz.Graph, maxDepth, baseMargin int) {
-	var setMargins func(node string, depth int)
-	setMargins = func(node string, depth int) {
-		marginValue := (maxDepth - depth + 1) * baseMargin
-		if subgraph, exists := graph.SubGraphs.SubGraphs[node]; exists {
-			subgraph.Attrs["margin"] = fmt.Sprintf(`"%d"`, marginValue)
-		}
-		for child := range graph.Relations.ParentToChildren[node] {
-			setMargins(child, depth+1)
-		}
-	}
-	for _, subgraph := range graph.SubGraphs.SubGraphs {
-		setMargins(subgraph.Name, 1)
+// SetSubgraphMargins sets the margin attribute for each group based on its depth, outer groups getting the largest.
+func SetSubgraphMargins(d *diagram.Diagram, maxDepth, baseMargin int) {
+	for _, group := range d.Groups() {
+		marginValue := (maxDepth - group.Depth() + 1) * baseMargin
+		group.Attrs["margin"] = fmt.Sprintf("%d", marginValue)
 	}
 }
 
 // TODO: Create func which puts consecutive identical resources on same rank
 // similar to what was done here: https://stackoverflow.com/questions/58832678/how-to-separate-picture-and-label-of-a-node-with-graphviz
 
-// AddImportantAttributesToLabels traverses nodes in the graph, checks if the node is in the important attributes resource list,
+// AddImportantAttributesToLabels traverses the resource nodes, checks if the resource type has important attributes,
 // calls GetImportantAttributes for the given node, and adds the result within the label field with newlines in between.
-func AddImportantAttributesToLabels(graph *gographviz.Graph, cfg *config.Config, handler *tfstatereader.TFStateHandler) error {
-	for _, node := range graph.Nodes.Nodes {
-		// Get the current label of the node
-		label := node.Attrs["label"]
-
-		// Remove existing quotes, if any
-		label = strings.Trim(label, `"`)
-
-		// Check if the node represents a resource
-		parts := strings.Split(label, ".")
-
-		// If the label is empty or doesn't contain a dot, skip the node
-		if len(parts) < 2 {
+func AddImportantAttributesToLabels(d *diagram.Diagram, cfg *config.Config, handler *tfstatereader.TFStateHandler) error {
+	for _, node := range d.Instances() {
+		// Check if the resource type has important attributes, wildcards included
+		if len(cfg.AttributesFor(node.Address.Type)) == 0 {
 			continue
 		}
 
-		resourceType := parts[0]
-		resourceName := parts[1]
-
-		// Check if the resource type is in the important attributes list
-		for _, resConfig := range cfg.ImportantAttributes {
-			if resConfig.Name == resourceType {
-				// Construct the resource identifier (e.g., azurerm_linux_virtual_machine.vm_1)
-				resourceIdentifier := fmt.Sprintf("%s.%s", resourceType, resourceName)
-
-				// Get important attributes for the resource
-				// fmt.Println("DEBUG: Will get important attributes for " + resourceIdentifier)
-				importantAttrs, err := handler.GetImportantAttributes(resourceIdentifier)
-				if err != nil {
-					return fmt.Errorf("failed to get important attributes for %s: %v", resourceIdentifier, err)
-				}
-
-				// Join important attributes with newlines
-				attrString := strings.Join(importantAttrs, "\\n")
-
-				// Update the label with important attributes
-				newLabel := fmt.Sprintf("%s\\n%s", label, attrString)
-				node.Attrs["label"] = fmt.Sprintf(`"%s"`, newLabel)
-				break
+		// Stacked nodes show the distinct values of their instances
+		if node.IsStacked() {
+			if summary := summariseAttributes(node, cfg, handler); len(summary) > 0 {
+				node.Label += "\n" + strings.Join(summary, "\n")
 			}
+			continue
 		}
-	}
 
-	return nil
-}
+		// The resource identifier is the full address (e.g., module.app.azurerm_linux_virtual_machine.vm_1[0])
+		resourceIdentifier := node.Address.String()
 
-// change to be foundGroupingResource
-// receive a node and check the label
-func contains(arr []string, str string) bool {
-	for _, item := range arr {
-		if item == str {
-			return true
+		// Get important attributes for the resource, resources which were not applied yet have none
+		importantAttrs, err := handler.GetImportantAttributes(resourceIdentifier)
+		if err != nil {
+			log.Printf("failed to get important attributes for %s: %v", resourceIdentifier, err)
+			continue
+		}
+		if len(importantAttrs) == 0 {
+			continue
 		}
-	}
-	return false
-}
-
-func FindNodeParent(nodeName string, graph *gographviz.Graph) string {
-	relations := graph.Relations
-	parents, ok := relations.ChildToParents[nodeName]
-	var nodeParent string
-
-	if !ok {
-		fmt.Printf("No parents found for node %s \n", nodeName) // might need to be an error and return
-	}
-
-	for parent := range parents {
-		// fmt.Printf("Parents of node %s is %s \n", nodeName, parent)
-		nodeParent = parent
-	}
-
-	return nodeParent
-
-}
-
-// SetChildOf function updates the relations in order to make nodeName a child of the given graph/subgraph,
-// nodeName can also be a subgraph
-func SetChildOf(graphName string, nodeName string, graph *gographviz.Graph) {
-	relations := graph.Relations
 
-	// Initialize parent-to-children and child-to-parents maps if they don't exist
-	if _, exists := relations.ParentToChildren[graphName]; !exists {
-		relations.ParentToChildren[graphName] = make(map[string]bool)
-	}
-	if _, exists := relations.ChildToParents[nodeName]; !exists {
-		relations.ChildToParents[nodeName] = make(map[string]bool)
+		// Update the label with important attributes, one per line
+		node.Label += "\n" + strings.Join(importantAttrs, "\n")
 	}
 
-	// Update relations
-	relations.ParentToChildren[graphName][nodeName] = true
-	relations.ChildToParents[nodeName][graphName] = true
-
-	// Optionally, you may want to remove the node from any other parents to ensure it is only a child of the specified graphName
-	for parent, children := range relations.ParentToChildren {
-		if parent != graphName {
-			delete(children, nodeName)
-		}
-	}
-	for child, parents := range relations.ChildToParents {
-		if child == nodeName && len(parents) > 1 {
-			for parent := range parents {
-				if parent != graphName {
-					delete(parents, parent)
-				}
-			}
-		}
-	}
+	return nil
 }
 
-func ExpandNodeCreatedWithList(graph *gographviz.Graph, handler *tfstatereader.TFStateHandler) {
-
-	copyOfNodes := graph.Nodes.Sorted()
-	for _, n := range copyOfNodes {
-
-		node := n.Name
-		// fmt.Println("Current node: " + node)
-		// Get the current label of the node
-		label := graph.Nodes.Lookup[node].Attrs["label"]
-		label = strings.Trim(label, `"`)
-
+// ExpandNodeCreatedWithList replaces every node of a resource expanded with count or for_each, on the resource
+// or on a module it lives in, with one node per instance found in the state. Instances of expanded modules,
+// e.g. module.net[0] and module.net[1], later get a cluster each.
+func ExpandNodeCreatedWithList(d *diagram.Diagram, handler *tfstatereader.TFStateHandler) {
+	for _, node := range d.Instances() {
 		// Check if the node was created with a list (count or for_each)
-		if handler.IsCreatedWithList(label) {
+		if !handler.IsCreatedWithList(node.ID) {
+			continue
+		}
 
-			// fmt.Println("DEBUG: found node created with list " + node)
+		// Get the list of actual names for the resource
+		resourceNames, err := handler.GetListOfNamesForResource(node.ID)
+		if err != nil {
+			log.Printf("error getting list of names for resource %s: %v", node.ID, err)
+			continue
+		}
 
-			// Get the list of actual names for the resource
-			resourceNames, err := handler.GetListOfNamesForResource(label)
+		// Create one node per instance in the group of the original node, with its attributes and edges
+		outgoing, incoming := d.EdgesFrom(node), d.EdgesTo(node)
+		for _, resourceName := range resourceNames {
+			instance, err := d.AddNode(resourceName, resourceName, node.Group)
 			if err != nil {
-				log.Printf("error getting list of names for resource %s: %v", label, err)
-				return
+				log.Printf("error adding instance %s: %v", resourceName, err)
+				continue
 			}
-
-			// Get the parent graph of the original node
-			parentGraph := FindNodeParent(node, graph)
-
-			// Create new nodes and edges based on the list of names
-			for _, resourceName := range resourceNames {
-				// Create a new node with the same attributes as the original node
-				newNodeName := strings.Replace(node, label, resourceName, 1)
-				newNodeAttrs := gographviz.Attrs{}
-				for k, v := range graph.Nodes.Lookup[node].Attrs {
-					newNodeAttrs[gographviz.Attr(k)] = v
-				}
-				newNodeAttrs["label"] = fmt.Sprintf(`"%s"`, resourceName)
-
-				// Add the new node to the graph
-				graph.AddNode(parentGraph, newNodeName, attrsToMap(newNodeAttrs))
-
-				// Create edges from the new node to all the destinations of the original node
-				for _, edgeList := range graph.Edges.SrcToDsts[node] {
-					for _, edge := range edgeList {
-						newEdge := gographviz.Edge{
-							Src:   newNodeName,
-							Dst:   edge.Dst,
-							Attrs: edge.Attrs.Copy(),
-						}
-						graph.AddEdge(newEdge.Src, newEdge.Dst, true, attrsToMap(newEdge.Attrs))
-					}
-				}
-
-				// Create edges to the new node from all the sources of the original node
-				for _, edgeList := range graph.Edges.DstToSrcs[node] {
-					for _, edge := range edgeList {
-						newEdge := gographviz.Edge{
-							Src:   edge.Src,
-							Dst:   newNodeName,
-							Attrs: edge.Attrs.Copy(),
-						}
-						graph.AddEdge(newEdge.Src, newEdge.Dst, true, attrsToMap(newEdge.Attrs))
-					}
-				}
+			instance.Icon = node.Icon
+			for key, value := range node.Attrs {
+				instance.Attrs[key] = value
 			}
 
-			// Remove the original node and its edges
-			graph.RemoveNode(parentGraph, node)
+			for _, edge := range outgoing {
+				d.CopyEdge(edge, instance, edge.To)
+			}
+			for _, edge := range incoming {
+				d.CopyEdge(edge, edge.From, instance)
+			}
 		}
 
+		// Remove the original node and its edges
+		d.RemoveNode(node)
 	}
-
-}
-
-func attrsToMap(attrs gographviz.Attrs) map[string]string {
-	result := make(map[string]string)
-	for k, v := range attrs {
-		result[string(k)] = v
-	}
-	return result
 }
 
-func CleanUpEdges(graph *gographviz.Graph) {
-	visited := make(map[string]bool)
-
-	var dfs func(node string)
-	dfs = func(node string) {
-		if visited[node] {
-			return
-		}
-		visited[node] = true
-
-		// Get the current label of the node
-		label := graph.Nodes.Lookup[node].Attrs["label"]
-		label = strings.Trim(label, `"`)
-
-		// Check if the node is a list node
-		var currentIndex string
-		if strings.Contains(label, "[") && strings.Contains(label, "]") {
-			currentIndex = label[strings.Index(label, "[")+1 : strings.Index(label, "]")]
+// CleanUpEdges removes the edges ExpandNodeCreatedWithList copied between instances which do not belong together.
+// Instances of different module instances, e.g. module.net[0] and module.net[1], never do. Otherwise the state
+// tells, when there is one: an instance whose recorded dependencies leave out the resource at the other end does not
+// depend on it, and an instance holding the id of some instances at the other end, e.g. a network interface whose
+// subnet_id is the id of one subnet instance, only depends on those. Without either, instances of two expanded
+// resources belong together when their keys are equal.
+func CleanUpEdges(d *diagram.Diagram, handler *tfstatereader.TFStateHandler) {
+	references := make(map[string]map[string]bool)
+	if handler != nil {
+		found, err := handler.References()
+		if err != nil {
+			log.Printf("failed to find references in the state: %v", err)
 		}
-
-		// Remove edges based on indices or keys
-		var edgesToRemove []*gographviz.Edge
-		for _, edgeList := range graph.Edges.SrcToDsts[node] {
-			for _, edge := range edgeList {
-				dstLabel := graph.Nodes.Lookup[edge.Dst].Attrs["label"]
-				dstLabel = strings.Trim(dstLabel, `"`)
-
-				var dstIndex string
-				if strings.Contains(dstLabel, "[") && strings.Contains(dstLabel, "]") {
-					dstIndex = dstLabel[strings.Index(dstLabel, "[")+1 : strings.Index(dstLabel, "]")]
-				}
-
-				if currentIndex != "" && dstIndex != "" && currentIndex != dstIndex {
-					edgesToRemove = append(edgesToRemove, edge)
-				}
+		for _, reference := range found {
+			to, err := address.Parse(reference.To)
+			if err != nil {
+				continue
 			}
+			if references[reference.From] == nil {
+				references[reference.From] = make(map[string]bool)
+			}
+			// Both the instance and its resource, which tells that the instances of the resource are told apart
+			references[reference.From][reference.To] = true
+			references[reference.From][to.WithoutKey().String()] = true
 		}
+	}
 
-		// Actually remove the edges
-		for _, edge := range edgesToRemove {
-			removeEdgeFromGraph(graph, edge)
+	for _, edge := range d.Edges() {
+		from, to := edge.From.Address, edge.To.Address
+		if from == nil || to == nil {
+			continue
 		}
 
-		// Visit all the children nodes
-		for _, edgeList := range graph.Edges.SrcToDsts[node] {
-			for _, edge := range edgeList {
-				dfs(edge.Dst)
+		if !from.SameModuleInstances(*to) {
+			d.RemoveEdge(edge)
+			continue
+		}
+		if !isExpanded(*from) && !isExpanded(*to) {
+			continue
+		}
+		if belong, known := belongTogether(edge, handler, references); known {
+			if !belong {
+				d.RemoveEdge(edge)
 			}
+			continue
 		}
-	}
-
-	// Start DFS from all top-level nodes
-	for _, node := range graph.Nodes.Nodes {
-		if !visited[node.Name] {
-			dfs(node.Name)
+		if from.Key != "" && to.Key != "" && from.Key != to.Key {
+			d.RemoveEdge(edge)
 		}
 	}
 }
 
-func removeEdgeFromGraph(graph *gographviz.Graph, edge *gographviz.Edge) {
-	// Remove the edge from SrcToDsts
-	srcEdges := graph.Edges.SrcToDsts[edge.Src][edge.Dst]
-	for i, e := range srcEdges {
-		if e.Dst == edge.Dst && e.Src == edge.Src {
-			graph.Edges.SrcToDsts[edge.Src][edge.Dst] = append(srcEdges[:i], srcEdges[i+1:]...)
-			break
-		}
-	}
+// isExpanded checks if an address is one of several instances, of the resource or of one of its modules.
+func isExpanded(addr address.Address) bool {
+	return addr.Key != "" || addr.String() != addr.WithoutModuleKeys().String()
+}
 
-	// Remove the edge from DstToSrcs
-	dstEdges := graph.Edges.DstToSrcs[edge.Dst][edge.Src]
-	for i, e := range dstEdges {
-		if e.Dst == edge.Dst && e.Src == edge.Src {
-			graph.Edges.DstToSrcs[edge.Dst][edge.Src] = append(dstEdges[:i], dstEdges[i+1:]...)
-			break
-		}
+// belongTogether tells from the state whether the instances at both ends of an edge belong together, known is
+// false when the state has nothing to tell.
+func belongTogether(edge *diagram.Edge, handler *tfstatereader.TFStateHandler, references map[string]map[string]bool) (belong, known bool) {
+	if handler == nil || !edge.From.IsInstance() || !edge.To.IsInstance() {
+		return false, false
 	}
 
-	// Remove the edge from the main edges list
-	for i, e := range graph.Edges.Edges {
-		if e.Dst == edge.Dst && e.Src == edge.Src {
-			graph.Edges.Edges = append(graph.Edges.Edges[:i], graph.Edges.Edges[i+1:]...)
-			break
+	if _, instance, ok := handler.FindInstance(edge.From.ID); ok && len(instance.Dependencies) > 0 {
+		resource := edge.To.Address.WithoutModuleKeys().WithoutKey().String()
+		if !address.Contains(instance.Dependencies, resource) {
+			return false, true
 		}
 	}
-}
-
-// findRootNode identifies the node with no outgoing edges.
-func findRootNode(graph *gographviz.Graph) string {
-	outDegree := make(map[string]int)
 
-	// Initialize out-degree for all nodes
-	for _, node := range graph.Nodes.Nodes {
-		outDegree[node.Name] = 0
+	if referenced := references[edge.From.ID]; referenced[edge.To.Address.WithoutKey().String()] {
+		return referenced[edge.To.ID], true
 	}
+	return false, false
+}
 
-	// Calculate out-degree for each node
-	for _, edge := range graph.Edges.Edges {
-		outDegree[edge.Src]++
+// findRootNode identifies a node with no outgoing edges.
+func findRootNode(d *diagram.Diagram) *diagram.Node {
+	roots := findRootNodes(d)
+	if len(roots) == 0 {
+		return nil
 	}
+	return roots[0]
+}
 
-	// Find the node with out-degree 0
-	for node, degree := range outDegree {
-		if degree == 0 {
-			return node
+// findRootNodes returns all nodes with out-degree 0, sorted by id.
+func findRootNodes(d *diagram.Diagram) []*diagram.Node {
+	var roots []*diagram.Node
+	for _, node := range d.Nodes() {
+		if len(d.EdgesFrom(node)) == 0 {
+			roots = append(roots, node)
 		}
 	}
-
-	return ""
+	return roots
 }
 
-// BFS performs a breadth-first search on the graph starting from the given node and returns the list of visited nodes.
-func BFS(graph *gographviz.Graph, startNode string) []string {
-	visited := make(map[string]bool)
-	queue := []string{startNode}
-	var visitedNodes []string
+// BFS performs a breadth-first search on the diagram starting from the given node, walking edges backwards,
+// and returns the list of visited nodes.
+func BFS(d *diagram.Diagram, startNode *diagram.Node) []*diagram.Node {
+	visited := make(map[*diagram.Node]bool)
+	queue := []*diagram.Node{startNode}
+	var visitedNodes []*diagram.Node
 
 	for len(queue) > 0 {
 		// Dequeue a node from the front of the queue
@@ -682,11 +512,9 @@ func BFS(graph *gographviz.Graph, startNode string) []string {
 		visitedNodes = append(visitedNodes, currentNode)
 
 		// Enqueue all parent nodes that have not been visited
-		for _, edge := range graph.Edges.DstToSrcs[currentNode] {
-			for _, e := range edge {
-				if !visited[e.Src] {
-					queue = append(queue, e.Src)
-				}
+		for _, edge := range d.EdgesTo(currentNode) {
+			if !visited[edge.From] {
+				queue = append(queue, edge.From)
 			}
 		}
 	}
@@ -694,93 +522,91 @@ func BFS(graph *gographviz.Graph, startNode string) []string {
 	return visitedNodes
 }
 
-func BetaCreateSubgraphsForGroupingNodes(graph *gographviz.Graph) {
+func BetaCreateSubgraphsForGroupingNodes(d *diagram.Diagram) {
 
-	nodes := BFS(graph, findRootNode(graph))
+	// Walk from every root, a graph spanning several clouds has one per provider at least
+	var nodes []*diagram.Node
+	seen := make(map[*diagram.Node]bool)
+	for _, root := range findRootNodes(d) {
+		for _, node := range BFS(d, root) {
+			if !seen[node] {
+				seen[node] = true
+				nodes = append(nodes, node)
+			}
+		}
+	}
 
 	for _, node := range nodes {
-		// Node is "azurerm_linux_virtual_machine.vm"
-		// Needed part is azurerm_linux_virtual_machine
-
-		if foundGroupingResource := isGroupingResource(node); foundGroupingResource {
-
-			// 1. Prepare cluster name for node
-
-			cleanNodeName := strings.Trim(node, `"`)
-			clusterName := fmt.Sprintf(`"%s"`, "cluster_"+cleanNodeName)
-			parentGraph := FindNodeParent(node, graph)
+		if !isGroupingResource(node) {
+			continue
+		}
 
-			// 2. Create the SubGraph
-			err := graph.AddSubGraph(parentGraph, clusterName, map[string]string{"label": clusterName})
-			if err != nil {
-				fmt.Println("ERROR: Got an error trying to add subgraph")
-			}
+		// 1. Create the group of the node, in the group the node is drawn in
+		clusterName := clusterNameFor(node)
+		cluster, err := d.AddGroup(clusterName, diagram.GroupResource, clusterName, node.Group)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "ERROR: Got an error trying to add subgraph")
+			continue
+		}
+		cluster.Address = node.Address
 
-			// 3. Add all reaching nodes as children of the new SubGraph
-			for _, reachingNode := range findAllReachingNodes(node, graph) {
-				SetChildOf(clusterName, reachingNode, graph)
+		// 2. Add all reaching nodes to the new group, keeping module clusters intact
+		for _, reachingNode := range findAllReachingNodes(node, d) {
+			child, childGroup := groupingChild(node, reachingNode, d)
+			switch {
+			case child != nil:
+				child.Group = cluster
+			case childGroup != nil && !childGroup.Contains(cluster):
+				childGroup.Parent = cluster
 			}
-
 		}
 	}
 
 }
 
 // HideEdgesBetweenSubgraphs visually hides edges between a grouping resource and another parent subgraph
-func HideEdgesBetweenSubgraphs(graph *gographviz.Graph) {
-	for _, edgeList := range graph.Edges.Edges {
-		if isGroupingResource(edgeList.Src) {
-			edgeList.Attrs.Add("style", "invis")
+func HideEdgesBetweenSubgraphs(d *diagram.Diagram) {
+	for _, edge := range d.Edges() {
+		if isGroupingResource(edge.From) {
+			edge.Hidden = true
 		}
 	}
 }
 
 // isGroupingResource checks is a node is a grouping resource
 // by verifying if the current node resource type is contained in the config.GroupingElement
-func isGroupingResource(node string) bool {
+func isGroupingResource(node *diagram.Node) bool {
 	groupingLabels := config.GetConfig().GroupingElements
-
-	cleanNodeName := strings.Trim(node, `"`)
-	if foundGroupingResource := contains(groupingLabels, strings.Split(cleanNodeName, ".")[0]); foundGroupingResource {
-		return true
-	}
-	return false
+	return node.IsInstance() && address.Contains(groupingLabels, node.Address.Type)
 }
 
 // Helper function bellow, even if some are unused, they are used during a debug session
 
-// CheckEdgeExistence checks if there is an edge from node1 to node2 in the graph.
-func CheckEdgeExistence(node1, node2 string, graph *gographviz.Graph) bool {
-	// Check if node1 has edges directed towards node2
-	if edges, exists := graph.Edges.SrcToDsts[node1]; exists {
-		for _, edgeList := range edges {
-			for _, edge := range edgeList {
-				if edge.Dst == node2 {
-					return true
-				}
-			}
+// CheckEdgeExistence checks if there is an edge from node1 to node2 in the diagram.
+func CheckEdgeExistence(node1, node2 *diagram.Node, d *diagram.Diagram) bool {
+	for _, edge := range d.EdgesFrom(node1) {
+		if edge.To == node2 {
+			return true
 		}
 	}
 	return false
 }
 
 // findAllReachingNodes performs a reverse DFS to find all nodes that can reach the given node.
-func findAllReachingNodes(targetNode string, graph *gographviz.Graph) []string {
-	visited := make(map[string]bool)
-	var result []string
+func findAllReachingNodes(targetNode *diagram.Node, d *diagram.Diagram) []*diagram.Node {
+	visited := make(map[*diagram.Node]bool)
+	var result []*diagram.Node
 
-	var reverseDfs func(string)
-	reverseDfs = func(n string) {
+	var reverseDfs func(*diagram.Node)
+	reverseDfs = func(n *diagram.Node) {
 		if visited[n] {
 			return
 		}
 		visited[n] = true
 		result = append(result, n)
 
-		if edges, ok := graph.Edges.DstToSrcs[n]; ok {
-			for src := range edges {
-				reverseDfs(src)
-			}
+		for _, edge := range d.EdgesTo(n) {
+			reverseDfs(edge.From)
 		}
 	}
 
@@ -789,22 +615,20 @@ func findAllReachingNodes(targetNode string, graph *gographviz.Graph) []string {
 }
 
 // findAllReachableNodes performs a DFS to find all reachable nodes from the given node.
-func findAllReachableNodes(startNode string, graph *gographviz.Graph) []string {
-	visited := make(map[string]bool)
-	var result []string
+func findAllReachableNodes(startNode *diagram.Node, d *diagram.Diagram) []*diagram.Node {
+	visited := make(map[*diagram.Node]bool)
+	var result []*diagram.Node
 
-	var dfs func(string)
-	dfs = func(n string) {
+	var dfs func(*diagram.Node)
+	dfs = func(n *diagram.Node) {
 		if visited[n] {
 			return
 		}
 		visited[n] = true
 		result = append(result, n)
 
-		if edges, ok := graph.Edges.SrcToDsts[n]; ok {
-			for dst := range edges {
-				dfs(dst)
-			}
+		for _, edge := range d.EdgesFrom(n) {
+			dfs(edge.To)
 		}
 	}
 
@@ -812,49 +636,30 @@ func findAllReachableNodes(startNode string, graph *gographviz.Graph) []string {
 	return result
 }
 
-// printRelations nicely prints the Relations struct from gographviz.Graph
-func printRelations(graph *gographviz.Graph) {
-	relations := graph.Relations
-
-	fmt.Println("ParentToChildren relationships:")
-	for parent, children := range relations.ParentToChildren {
-		fmt.Printf("Parent: %s", parent)
-		for child := range children {
-			fmt.Printf("  Child: %s ;", child)
+// printGroups nicely prints the group every node and group is drawn in
+func printGroups(d *diagram.Diagram) {
+	fmt.Println("Groups:")
+	for _, group := range d.Groups() {
+		parent := d.Name
+		if group.Parent != nil {
+			parent = group.Parent.ID
 		}
-		fmt.Println()
+		fmt.Printf("Group: %s  Parent: %s\n", group.ID, parent)
 	}
 
-	fmt.Println("\nChildToParents relationships:")
-	for child, parents := range relations.ChildToParents {
-		fmt.Printf("Child: %s", child)
-		for parent := range parents {
-			fmt.Printf("  Parent: %s ;", parent)
+	fmt.Println("\nNodes:")
+	for _, node := range d.Nodes() {
+		parent := d.Name
+		if node.Group != nil {
+			parent = node.Group.ID
 		}
-		fmt.Println()
-	}
-}
-
-// printEdges prints all edges in the graph.
-func printEdges(graph *gographviz.Graph) {
-	for _, edge := range graph.Edges.Sorted() {
-		fmt.Printf("Edge: %s -> %s\n", edge.Src, edge.Dst)
+		fmt.Printf("Node: %s  Parent: %s\n", node.ID, parent)
 	}
 }
 
-func downloadImage(url, filePath string) error {
-	resp, err := http.Get(url)
-	if err != nil {
-		return err
+// printEdges prints all edges in the diagram.
+func printEdges(d *diagram.Diagram) {
+	for _, edge := range d.Edges() {
+		fmt.Printf("Edge: %s -> %s\n", edge.From.ID, edge.To.ID)
 	}
-	defer resp.Body.Close()
-
-	out, err := os.Create(filePath)
-	if err != nil {
-		return err
-	}
-	defer out.Close()
-
-	_, err = io.Copy(out, resp.Body)
-	return err
 }
@@ -0,0 +1,184 @@
+package graph
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/CiucurDaniel/terraview/internal/config"
+	"github.com/CiucurDaniel/terraview/internal/diagram"
+	"github.com/CiucurDaniel/terraview/internal/tfstatereader"
+)
+
+// newDiagram returns a diagram with a node per id and an edge for every pair of ids.
+func newDiagram(t *testing.T, ids []string, edges [][2]string) *diagram.Diagram {
+	t.Helper()
+	d := diagram.New("G")
+	for _, id := range ids {
+		if _, err := d.AddNode(id, id, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, edge := range edges {
+		d.AddEdge(d.Node(edge[0]), d.Node(edge[1]), diagram.EdgeDependency)
+	}
+	return d
+}
+
+func TestCleanUpEdges(t *testing.T) {
+	d := newDiagram(t,
+		[]string{`module.net[0].azurerm_subnet.this`, `module.net[1].azurerm_subnet.this`, `module.net[0].azurerm_virtual_network.this`, `azurerm_network_interface.nic["web"]`, `azurerm_subnet.sn["web"]`, `azurerm_subnet.sn["db"]`},
+		[][2]string{
+			{`module.net[0].azurerm_subnet.this`, `module.net[0].azurerm_virtual_network.this`},
+			{`module.net[1].azurerm_subnet.this`, `module.net[0].azurerm_virtual_network.this`},
+			{`azurerm_network_interface.nic["web"]`, `azurerm_subnet.sn["web"]`},
+			{`azurerm_network_interface.nic["web"]`, `azurerm_subnet.sn["db"]`},
+		})
+
+	CleanUpEdges(d, nil)
+
+	var kept []string
+	for _, edge := range d.Edges() {
+		kept = append(kept, edge.From.ID+" -> "+edge.To.ID)
+	}
+	want := []string{
+		`module.net[0].azurerm_subnet.this -> module.net[0].azurerm_virtual_network.this`,
+		`azurerm_network_interface.nic["web"] -> azurerm_subnet.sn["web"]`,
+	}
+	if len(kept) != len(want) || kept[0] != want[0] || kept[1] != want[1] {
+		t.Errorf("kept edges %q, want %q", kept, want)
+	}
+}
+
+func TestCleanUpEdgesWithState(t *testing.T) {
+	handler, err := tfstatereader.NewTFStateHandler("../tfstatereader/testdata/references.tfstate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := newDiagram(t,
+		[]string{`azurerm_linux_virtual_machine.vm`, `azurerm_network_interface.nic[0]`, `azurerm_network_interface.nic[1]`, `azurerm_subnet.sn["app"]`, `azurerm_subnet.sn["web"]`, `azurerm_resource_group.rg`},
+		[][2]string{
+			{`azurerm_linux_virtual_machine.vm`, `azurerm_network_interface.nic[0]`},
+			{`azurerm_linux_virtual_machine.vm`, `azurerm_network_interface.nic[1]`},
+			{`azurerm_network_interface.nic[0]`, `azurerm_subnet.sn["app"]`},
+			{`azurerm_network_interface.nic[0]`, `azurerm_subnet.sn["web"]`},
+			{`azurerm_network_interface.nic[1]`, `azurerm_subnet.sn["app"]`},
+			{`azurerm_network_interface.nic[1]`, `azurerm_subnet.sn["web"]`},
+			{`azurerm_network_interface.nic[0]`, `azurerm_resource_group.rg`},
+			{`azurerm_network_interface.nic[1]`, `azurerm_linux_virtual_machine.vm`},
+		})
+
+	CleanUpEdges(d, handler)
+
+	var kept []string
+	for _, edge := range d.Edges() {
+		kept = append(kept, edge.From.ID+" -> "+edge.To.ID)
+	}
+	// Keys tell nothing here, the subnet_id and network_interface_ids do, and the dependencies of nic[1] leave out the vm
+	want := []string{
+		`azurerm_linux_virtual_machine.vm -> azurerm_network_interface.nic[1]`,
+		`azurerm_network_interface.nic[0] -> azurerm_subnet.sn["web"]`,
+		`azurerm_network_interface.nic[1] -> azurerm_subnet.sn["app"]`,
+		`azurerm_network_interface.nic[0] -> azurerm_resource_group.rg`,
+	}
+	if !reflect.DeepEqual(kept, want) {
+		t.Errorf("kept edges %q, want %q", kept, want)
+	}
+}
+
+func TestInferReferences(t *testing.T) {
+	handler, err := tfstatereader.NewTFStateHandler("../tfstatereader/testdata/references.tfstate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := newDiagram(t,
+		[]string{`azurerm_linux_virtual_machine.vm`, `azurerm_network_interface.nic[0]`, `azurerm_network_interface.nic[1]`, `azurerm_subnet.sn["app"]`, `azurerm_subnet.sn["web"]`},
+		[][2]string{{`azurerm_network_interface.nic[0]`, `azurerm_subnet.sn["web"]`}})
+
+	InferReferences(d, handler)
+
+	var edges []string
+	for _, edge := range d.Edges() {
+		edges = append(edges, edge.From.ID+" -> "+edge.To.ID+" "+edge.Type+" "+edge.Label)
+	}
+	want := []string{
+		`azurerm_network_interface.nic[0] -> azurerm_subnet.sn["web"] dependency `,
+		`azurerm_linux_virtual_machine.vm -> azurerm_network_interface.nic[1] reference network_interface_ids`,
+		`azurerm_network_interface.nic[1] -> azurerm_subnet.sn["app"] reference subnet_id`,
+	}
+	if !reflect.DeepEqual(edges, want) {
+		t.Errorf("edges %q, want %q", edges, want)
+	}
+}
+
+func TestStackInstances(t *testing.T) {
+	d := newDiagram(t,
+		[]string{`azurerm_linux_virtual_machine.vm[0]`, `azurerm_linux_virtual_machine.vm[1]`, `azurerm_linux_virtual_machine.vm[2]`, `azurerm_network_interface.nic["a"]`, `azurerm_network_interface.nic["b"]`, `azurerm_resource_group.rg`},
+		[][2]string{
+			{`azurerm_linux_virtual_machine.vm[0]`, `azurerm_network_interface.nic["a"]`},
+			{`azurerm_linux_virtual_machine.vm[1]`, `azurerm_network_interface.nic["b"]`},
+			{`azurerm_linux_virtual_machine.vm[2]`, `azurerm_network_interface.nic["b"]`},
+			{`azurerm_linux_virtual_machine.vm[0]`, `azurerm_resource_group.rg`},
+			{`azurerm_linux_virtual_machine.vm[1]`, `azurerm_resource_group.rg`},
+		})
+	cfg := &config.Config{StackInstances: map[string]int{"azurerm_linux_virtual_machine": 2, "azurerm_*": 5, "*": 1}}
+
+	StackInstances(d, cfg)
+
+	stack := d.Node("azurerm_linux_virtual_machine.vm")
+	if stack == nil || !stack.IsStacked() || len(stack.Stacked) != 3 || stack.Resource == nil {
+		t.Fatalf("instances were not stacked: %+v", stack)
+	}
+	if stack.Label != "azurerm_linux_virtual_machine.vm\n×3" || stack.Attrs["tooltip"] != "keys: 0, 1, 2" {
+		t.Errorf("unexpected stacked node %+v", stack)
+	}
+	if d.Node("azurerm_linux_virtual_machine.vm[0]") != nil || len(stack.Resource.Instances) != 1 {
+		t.Error("stacked instances are left")
+	}
+	if d.Node(`azurerm_network_interface.nic["a"]`) == nil {
+		t.Error("instances below the threshold were stacked")
+	}
+
+	var kept []string
+	for _, edge := range d.Edges() {
+		kept = append(kept, edge.From.ID+" -> "+edge.To.ID)
+	}
+	want := []string{
+		`azurerm_linux_virtual_machine.vm -> azurerm_network_interface.nic["a"]`,
+		`azurerm_linux_virtual_machine.vm -> azurerm_network_interface.nic["b"]`,
+		`azurerm_linux_virtual_machine.vm -> azurerm_resource_group.rg`,
+	}
+	if len(kept) != len(want) || kept[0] != want[0] || kept[1] != want[1] || kept[2] != want[2] {
+		t.Errorf("kept edges %q, want %q", kept, want)
+	}
+}
+
+func TestCreateModuleClusters(t *testing.T) {
+	d := newDiagram(t, []string{`module.net[0].module.subnets["a"].azurerm_subnet.this`, `module.app`, `azurerm_resource_group.rg`}, nil)
+
+	CreateModuleClusters(d)
+
+	subnet := d.Node(`module.net[0].module.subnets["a"].azurerm_subnet.this`)
+	if subnet.Group == nil || subnet.Group.ID != `cluster_module.net[0].module.subnets["a"]` || subnet.Group.Label != `module.subnets["a"]` {
+		t.Fatalf("unexpected group %+v", subnet.Group)
+	}
+	if parent := subnet.Group.Parent; parent == nil || parent.ID != "cluster_module.net[0]" || parent.Parent != nil || parent.Kind != diagram.GroupModule {
+		t.Errorf("unexpected parent group %+v", parent)
+	}
+	if d.Node("module.app").Group != nil || d.Node("azurerm_resource_group.rg").Group != nil {
+		t.Error("nodes of the root module were put into a group")
+	}
+}
+
+func TestRemoveResourceTypeFromLabels(t *testing.T) {
+	d := newDiagram(t, []string{`module.net[0].azurerm_subnet.this["web"]`, "var.location"}, nil)
+	d.Node(`module.net[0].azurerm_subnet.this["web"]`).Label += "\naddress_prefixes: 10.0.1.0/24"
+
+	RemoveResourceTypeFromLabels(d)
+
+	if label := d.Node(`module.net[0].azurerm_subnet.this["web"]`).Label; label != "this\naddress_prefixes: 10.0.1.0/24" {
+		t.Errorf("unexpected label %q", label)
+	}
+	if label := d.Node("var.location").Label; label != "var.location" {
+		t.Errorf("unexpected label %q", label)
+	}
+}
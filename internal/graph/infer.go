@@ -0,0 +1,66 @@
+package graph
+
+import (
+	"log"
+	"strings"
+
+	"github.com/CiucurDaniel/terraview/internal/address"
+	"github.com/CiucurDaniel/terraview/internal/diagram"
+	"github.com/CiucurDaniel/terraview/internal/tfstatereader"
+)
+
+// InferReferences adds an edge for every attribute in the state holding the id of another resource, e.g. the
+// subnet_id of a network interface, labeled with the attribute and dashed. It connects resources wired together
+// through variables, remote state or hardcoded ids, which the dependency graph leaves apart. Nodes which are
+// connected already are left alone, several attributes referencing the same node share one edge.
+func InferReferences(d *diagram.Diagram, handler *tfstatereader.TFStateHandler) {
+	references, err := handler.References()
+	if err != nil {
+		log.Printf("failed to find references in the state: %v", err)
+		return
+	}
+
+	inferred := make(map[[2]*diagram.Node]*diagram.Edge)
+	for _, reference := range references {
+		for _, from := range nodesHolding(d, reference.From) {
+			for _, to := range nodesHolding(d, reference.To) {
+				if from == to {
+					continue
+				}
+				if edge, exists := inferred[[2]*diagram.Node{from, to}]; exists {
+					if !address.Contains(strings.Split(edge.Label, ", "), reference.Attribute) {
+						edge.Label += ", " + reference.Attribute
+					}
+					continue
+				}
+				if CheckEdgeExistence(from, to, d) || CheckEdgeExistence(to, from, d) {
+					continue
+				}
+
+				edge := d.AddEdge(from, to, diagram.EdgeReference)
+				edge.Label = reference.Attribute
+				edge.Attrs["style"] = "dashed"
+				inferred[[2]*diagram.Node{from, to}] = edge
+			}
+		}
+	}
+}
+
+// nodesHolding returns the nodes an instance is drawn in: its own node, the node of its whole resource or stack,
+// or the box of the collapsed module it lives in.
+func nodesHolding(d *diagram.Diagram, instance string) []*diagram.Node {
+	if nodes := findNodesCovering(d, instance); len(nodes) > 0 {
+		return nodes
+	}
+
+	addr, err := address.Parse(instance)
+	if err != nil {
+		return nil
+	}
+	for depth := len(addr.Module); depth > 0; depth-- {
+		if node := d.Node(address.Address{Module: addr.Module[:depth]}.String()); node != nil {
+			return []*diagram.Node{node}
+		}
+	}
+	return nil
+}
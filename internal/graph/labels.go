@@ -0,0 +1,122 @@
+package graph
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"text/template"
+
+	"github.com/CiucurDaniel/terraview/internal/address"
+	"github.com/CiucurDaniel/terraview/internal/config"
+	"github.com/CiucurDaniel/terraview/internal/diagram"
+	"github.com/CiucurDaniel/terraview/internal/tfstatereader"
+)
+
+// LabelData is passed to the label templates configured per resource type.
+type LabelData struct {
+	Address    string // full address, e.g. module.app.azurerm_linux_virtual_machine.vm["web"]
+	Type       string
+	Name       string
+	Key        string // count index or for_each key, e.g. 0 or web, empty when not expanded
+	Module     string // module path, e.g. module.app
+	Attributes map[string]interface{}
+	Important  []string // the important attributes formatted as "attr: value"
+}
+
+// Attr returns the formatted value found at an attribute path, e.g. {{.Attr "os_disk[0].caching"}}
+func (d LabelData) Attr(path string) string {
+	if d.Attributes == nil {
+		return ""
+	}
+	values, err := tfstatereader.EvaluatePath(d.Attributes, path)
+	if err != nil {
+		return ""
+	}
+	var formatted []string
+	for _, value := range values {
+		if text := tfstatereader.FormatValue(value); text != "" {
+			formatted = append(formatted, text)
+		}
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// ApplyLabelTemplates replaces the label of every resource whose type has a label template configured.
+// Grouping resources get the rendered label on their cluster. The handler may be nil, in which case
+// templates only have the address parts available. Stacked nodes keep their label, templates render one instance.
+func ApplyLabelTemplates(d *diagram.Diagram, cfg *config.Config, handler *tfstatereader.TFStateHandler) {
+	templates := make(map[string]*template.Template)
+
+	for _, node := range d.Instances() {
+		if node.IsStacked() {
+			continue
+		}
+		addr := *node.Address
+		text := cfg.LabelTemplateFor(addr.Type)
+		if text == "" {
+			continue
+		}
+
+		tmpl, exists := templates[text]
+		if !exists {
+			var err error
+			tmpl, err = template.New(addr.Type).Option("missingkey=zero").Parse(text)
+			if err != nil {
+				log.Printf("invalid label template for %s: %v", addr.Type, err)
+			}
+			templates[text] = tmpl
+		}
+		if tmpl == nil {
+			continue
+		}
+
+		label, err := renderLabel(tmpl, newLabelData(addr, cfg, handler))
+		if err != nil {
+			log.Printf("failed to render label for %s: %v", addr, err)
+			continue
+		}
+
+		node.Label = label
+		if group := d.Group(clusterNameFor(node)); group != nil {
+			group.Label = label
+		}
+	}
+}
+
+// newLabelData collects what a template can use for a resource.
+func newLabelData(addr address.Address, cfg *config.Config, handler *tfstatereader.TFStateHandler) LabelData {
+	data := LabelData{
+		Address: addr.String(),
+		Type:    addr.Type,
+		Name:    addr.Name,
+		Key:     strings.Trim(addr.Key, `"`),
+		Module:  addr.ModulePath(),
+	}
+	if handler == nil {
+		return data
+	}
+
+	if attributes, err := handler.GetAttributes(data.Address); err == nil {
+		data.Attributes = attributes
+	}
+	if len(cfg.AttributesFor(addr.Type)) > 0 {
+		data.Important, _ = handler.GetImportantAttributes(data.Address)
+	}
+	return data
+}
+
+// renderLabel executes the template, leaving out the values missing from the attributes.
+func renderLabel(tmpl *template.Template, data LabelData) (string, error) {
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", err
+	}
+
+	// Missing keys of the attributes are nil, which text/template prints as <no value> even with missingkey=zero
+	return strings.TrimSpace(strings.ReplaceAll(out.String(), "<no value>", "")), nil
+}
+
+// clusterNameFor returns the id of the cluster created for a grouping node.
+func clusterNameFor(node *diagram.Node) string {
+	return "cluster_" + node.ID
+}
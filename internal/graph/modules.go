@@ -0,0 +1,167 @@
+package graph
+
+import (
+	"strings"
+
+	"github.com/CiucurDaniel/terraview/internal/address"
+	"github.com/CiucurDaniel/terraview/internal/diagram"
+)
+
+// ModuleInterfaceProvider is implemented by graph sources which know the configuration of the modules,
+// so collapsed modules can show their inputs and outputs.
+type ModuleInterfaceProvider interface {
+	// ModuleInterface returns the input and output names of the module called at modulePath, e.g. module.network
+	ModuleInterface(modulePath string) (inputs []string, outputs []string, ok bool)
+}
+
+// CreateModuleClusters puts the nodes of every module instance, e.g. module.app[0] or module.app["web"],
+// into its own labeled cluster. Clusters of child modules are nested in the cluster of their parent.
+func CreateModuleClusters(d *diagram.Diagram) {
+	for _, node := range d.Nodes() {
+		steps := moduleSteps(node)
+		if len(steps) == 0 {
+			continue
+		}
+
+		node.Group = ensureModuleCluster(d, steps)
+	}
+}
+
+// moduleSteps returns the module instance a node lives in. A module call node, like a collapsed module
+// or a module whose source could not be read, lives in the module calling it.
+func moduleSteps(node *diagram.Node) []address.ModuleStep {
+	if node.Address == nil {
+		return nil
+	}
+	if node.IsModuleCall() {
+		return node.Address.Module[:len(node.Address.Module)-1]
+	}
+	return node.Address.Module
+}
+
+// moduleClusterName returns the id of the cluster holding the nodes of a module instance.
+func moduleClusterName(steps []address.ModuleStep) string {
+	return "cluster_" + address.Address{Module: steps}.ModulePath()
+}
+
+// ensureModuleCluster creates the clusters for a module instance and all its parents and returns the innermost one.
+func ensureModuleCluster(d *diagram.Diagram, steps []address.ModuleStep) *diagram.Group {
+	var parent *diagram.Group
+	for i := range steps {
+		group := d.Group(moduleClusterName(steps[:i+1]))
+		if group == nil {
+			group, _ = d.AddGroup(moduleClusterName(steps[:i+1]), diagram.GroupModule, steps[i].String(), parent)
+			group.Address = &address.Address{Module: append([]address.ModuleStep(nil), steps[:i+1]...)}
+		}
+		parent = group
+	}
+	return parent
+}
+
+// groupingChild returns what has to be moved into the cluster of groupingNode so reachingNode ends up inside it,
+// without tearing module clusters apart. A node in the same module is moved itself, a node in a child module
+// is moved together with its whole module cluster and nodes in other modules are left where they are.
+func groupingChild(groupingNode, reachingNode *diagram.Node, d *diagram.Diagram) (*diagram.Node, *diagram.Group) {
+	groupSteps := moduleSteps(groupingNode)
+	nodeSteps := moduleSteps(reachingNode)
+
+	if len(nodeSteps) < len(groupSteps) {
+		return nil, nil
+	}
+	for i := range groupSteps {
+		if groupSteps[i] != nodeSteps[i] {
+			return nil, nil
+		}
+	}
+	if len(nodeSteps) == len(groupSteps) {
+		return reachingNode, nil
+	}
+
+	cluster := d.Group(moduleClusterName(nodeSteps[:len(groupSteps)+1]))
+	if cluster == nil {
+		return reachingNode, nil
+	}
+	return nil, cluster
+}
+
+// CollapseModules replaces every instance of the given modules with a single box showing the module's
+// inputs and outputs. Modules are given by their configuration path, e.g. module.network or network.
+// Edges from and to nodes inside the module are moved to the box.
+func CollapseModules(d *diagram.Diagram, modules []string, provider ModuleInterfaceProvider) {
+	if len(modules) == 0 {
+		return
+	}
+
+	targets := make(map[string]bool)
+	for _, module := range modules {
+		if !strings.HasPrefix(module, "module.") {
+			module = "module." + module
+		}
+		targets[module] = true
+	}
+
+	// Find the collapsed instance every node belongs to
+	replacement := make(map[*diagram.Node]string)
+	for _, node := range d.Nodes() {
+		if node.Address == nil {
+			continue
+		}
+		for depth := 1; depth <= len(node.Address.Module); depth++ {
+			instance := address.Address{Module: node.Address.Module[:depth]}
+			if targets[instance.ConfigModulePath()] {
+				replacement[node] = instance.ModulePath()
+				break
+			}
+		}
+	}
+	if len(replacement) == 0 {
+		return
+	}
+
+	// Add one box per module instance, a node of the module call already drawn becomes the box
+	boxes := make(map[string]*diagram.Node)
+	for _, node := range d.Nodes() {
+		id, replaced := replacement[node]
+		if !replaced || boxes[id] != nil {
+			continue
+		}
+		box := d.Node(id)
+		if box == nil {
+			addr, _ := address.Parse(id)
+			label := addr.ModulePath()
+			if provider != nil {
+				if inputs, outputs, ok := provider.ModuleInterface(addr.ConfigModulePath()); ok {
+					label += "\n\ninputs: " + strings.Join(inputs, ", ") + "\noutputs: " + strings.Join(outputs, ", ")
+				}
+			}
+			box, _ = d.AddNode(id, label, nil)
+			box.Attrs["shape"] = "box3d"
+		}
+		boxes[id] = box
+	}
+
+	// Move the edges to the boxes, dropping the ones inside a module and duplicates
+	seen := make(map[string]bool)
+	for _, edge := range d.Edges() {
+		d.RemoveEdge(edge)
+
+		from, to := edge.From, edge.To
+		if id, ok := replacement[from]; ok {
+			from = boxes[id]
+		}
+		if id, ok := replacement[to]; ok {
+			to = boxes[id]
+		}
+		if from == to || seen[from.ID+"->"+to.ID] {
+			continue
+		}
+		seen[from.ID+"->"+to.ID] = true
+		d.CopyEdge(edge, from, to)
+	}
+
+	for node, id := range replacement {
+		if boxes[id] != node {
+			d.RemoveNode(node)
+		}
+	}
+}
@@ -0,0 +1,384 @@
+package graph
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/CiucurDaniel/terraview/internal/config"
+	"github.com/CiucurDaniel/terraview/internal/diagram"
+	"github.com/CiucurDaniel/terraview/internal/icons"
+	"github.com/CiucurDaniel/terraview/internal/tfstatereader"
+)
+
+// Pass is one step of the pipeline turning the graph of a source into a diagram, changing the diagram in place.
+type Pass func(d *diagram.Diagram, ctx *PassContext) error
+
+// PassContext is what a pass works with besides the diagram.
+type PassContext struct {
+	Config    *config.Config
+	Handler   *tfstatereader.TFStateHandler // nil when no state is available
+	Source    GraphSource
+	AssetsDir string // where icons are written, the image path of the diagram
+	Params    Params // params of the step in the pipeline section, empty by default
+}
+
+// Params are the parameters of a pipeline step as read from YAML. The getters return the default for a
+// missing parameter and an error for a value of the wrong type.
+type Params map[string]interface{}
+
+// Float returns a number parameter.
+func (p Params) Float(name string, def float64) (float64, error) {
+	switch value := p[name].(type) {
+	case nil:
+		return def, nil
+	case int:
+		return float64(value), nil
+	case float64:
+		return value, nil
+	default:
+		return 0, fmt.Errorf("param %s must be a number, got %v", name, value)
+	}
+}
+
+// Int returns a whole number parameter.
+func (p Params) Int(name string, def int) (int, error) {
+	switch value := p[name].(type) {
+	case nil:
+		return def, nil
+	case int:
+		return value, nil
+	default:
+		return 0, fmt.Errorf("param %s must be a whole number, got %v", name, value)
+	}
+}
+
+// String returns a text parameter.
+func (p Params) String(name, def string) (string, error) {
+	switch value := p[name].(type) {
+	case nil:
+		return def, nil
+	case string:
+		return value, nil
+	default:
+		return "", fmt.Errorf("param %s must be a string, got %v", name, value)
+	}
+}
+
+// Strings returns a list parameter, nil when missing.
+func (p Params) Strings(name string) ([]string, error) {
+	values, ok := p[name].([]interface{})
+	if p[name] != nil && !ok {
+		return nil, fmt.Errorf("param %s must be a list, got %v", name, p[name])
+	}
+	var result []string
+	for _, value := range values {
+		text, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("param %s must be a list of strings, got %v", name, value)
+		}
+		result = append(result, text)
+	}
+	return result, nil
+}
+
+// DumpFunc is called after every pass with its name and the diagram as the pass left it.
+type DumpFunc func(pass string, d *diagram.Diagram) error
+
+// DefaultPipeline is the sequence of passes run when the configuration has no pipeline section.
+var DefaultPipeline = []string{
+	"graph_attributes",
+	"expand_instances",
+	"clean_up_edges",
+	"stack_instances",
+	"collapse_modules",
+	"module_clusters",
+	"grouping_clusters",
+	"infer_references",
+	"icons",
+	"node_label_position",
+	"group_label_position",
+	"font_sizes",
+	"node_margins",
+	"group_margins",
+	"hide_grouping_edges",
+	"important_attributes",
+	"grouping_labels",
+	"short_labels",
+	"label_templates",
+	"hide_grouping_labels",
+}
+
+var (
+	passes      = make(map[string]Pass)
+	passesMutex sync.RWMutex
+)
+
+func init() {
+	for name, pass := range map[string]Pass{
+		"graph_attributes":     graphAttributesPass,
+		"expand_instances":     expandInstancesPass,
+		"clean_up_edges":       cleanUpEdgesPass,
+		"stack_instances":      stackInstancesPass,
+		"collapse_modules":     collapseModulesPass,
+		"module_clusters":      moduleClustersPass,
+		"grouping_clusters":    groupingClustersPass,
+		"infer_references":     inferReferencesPass,
+		"icons":                iconsPass,
+		"node_label_position":  nodeLabelPositionPass,
+		"group_label_position": groupLabelPositionPass,
+		"font_sizes":           fontSizesPass,
+		"node_margins":         nodeMarginsPass,
+		"group_margins":        groupMarginsPass,
+		"hide_grouping_edges":  hideGroupingEdgesPass,
+		"important_attributes": importantAttributesPass,
+		"grouping_labels":      groupingLabelsPass,
+		"short_labels":         shortLabelsPass,
+		"label_templates":      labelTemplatesPass,
+		"hide_grouping_labels": hideGroupingLabelsPass,
+	} {
+		if err := RegisterPass(name, pass); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// RegisterPass makes a pass available to the pipeline section of the configuration under name.
+// Names are unique, registering a name twice fails.
+func RegisterPass(name string, pass Pass) error {
+	if name == "" || pass == nil {
+		return fmt.Errorf("a pass needs a name and a function")
+	}
+
+	passesMutex.Lock()
+	defer passesMutex.Unlock()
+	if _, exists := passes[name]; exists {
+		return fmt.Errorf("pass %s is already registered", name)
+	}
+	passes[name] = pass
+	return nil
+}
+
+// RegisteredPasses returns the names of every registered pass, sorted.
+func RegisteredPasses() []string {
+	passesMutex.RLock()
+	defer passesMutex.RUnlock()
+
+	names := make([]string, 0, len(passes))
+	for name := range passes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Pipeline returns the enabled steps of the pipeline section, or the default pipeline without one.
+// Every step must name a registered pass.
+func Pipeline(cfg *config.Config) ([]config.PipelineStep, error) {
+	if len(cfg.Pipeline) == 0 {
+		steps := make([]config.PipelineStep, len(DefaultPipeline))
+		for i, name := range DefaultPipeline {
+			steps[i] = config.PipelineStep{Pass: name}
+		}
+		return steps, nil
+	}
+
+	passesMutex.RLock()
+	defer passesMutex.RUnlock()
+
+	var steps []config.PipelineStep
+	for _, step := range cfg.Pipeline {
+		if _, exists := passes[step.Pass]; !exists {
+			return nil, fmt.Errorf("unknown pass %q in pipeline", step.Pass)
+		}
+		if step.IsEnabled() {
+			steps = append(steps, step)
+		}
+	}
+	return steps, nil
+}
+
+// RunPipeline runs the steps on the diagram in order. dump, if not nil, is called after every step.
+func RunPipeline(d *diagram.Diagram, steps []config.PipelineStep, ctx PassContext, dump DumpFunc) error {
+	for _, step := range steps {
+		passesMutex.RLock()
+		pass, exists := passes[step.Pass]
+		passesMutex.RUnlock()
+		if !exists {
+			return fmt.Errorf("unknown pass %q in pipeline", step.Pass)
+		}
+
+		stepContext := ctx
+		stepContext.Params = step.Params
+		if err := pass(d, &stepContext); err != nil {
+			return fmt.Errorf("pass %s: %v", step.Pass, err)
+		}
+
+		if dump != nil {
+			if err := dump(step.Pass, d); err != nil {
+				return fmt.Errorf("failed to dump the diagram after %s: %v", step.Pass, err)
+			}
+		}
+	}
+	return nil
+}
+
+// graphAttributesPass sets the graph attributes of SetGraphAttrs, any param is set as a graph attribute on top.
+func graphAttributesPass(d *diagram.Diagram, ctx *PassContext) error {
+	SetGraphAttrs(d)
+	for name, value := range ctx.Params {
+		d.Attrs[name] = fmt.Sprint(value)
+	}
+	return nil
+}
+
+func expandInstancesPass(d *diagram.Diagram, ctx *PassContext) error {
+	if ctx.Handler != nil {
+		ExpandNodeCreatedWithList(d, ctx.Handler)
+	}
+	return nil
+}
+
+func cleanUpEdgesPass(d *diagram.Diagram, ctx *PassContext) error {
+	CleanUpEdges(d, ctx.Handler)
+	return nil
+}
+
+func stackInstancesPass(d *diagram.Diagram, ctx *PassContext) error {
+	StackInstances(d, ctx.Config)
+	return nil
+}
+
+// collapseModulesPass collapses the modules of the configuration and of the modules param.
+func collapseModulesPass(d *diagram.Diagram, ctx *PassContext) error {
+	modules, err := ctx.Params.Strings("modules")
+	if err != nil {
+		return err
+	}
+	provider, _ := ctx.Source.(ModuleInterfaceProvider)
+	CollapseModules(d, append(append([]string{}, ctx.Config.CollapseModules...), modules...), provider)
+	return nil
+}
+
+func moduleClustersPass(d *diagram.Diagram, ctx *PassContext) error {
+	CreateModuleClusters(d)
+	return nil
+}
+
+func groupingClustersPass(d *diagram.Diagram, ctx *PassContext) error {
+	BetaCreateSubgraphsForGroupingNodes(d)
+	return nil
+}
+
+func inferReferencesPass(d *diagram.Diagram, ctx *PassContext) error {
+	if ctx.Handler != nil {
+		InferReferences(d, ctx.Handler)
+	}
+	return nil
+}
+
+func iconsPass(d *diagram.Diagram, ctx *PassContext) error {
+	pack, err := icons.NewPack(ctx.Config)
+	if err != nil {
+		return fmt.Errorf("invalid icon configuration: %v", err)
+	}
+	AddImageLabel(d, ctx.AssetsDir, pack)
+	return nil
+}
+
+// nodeLabelPositionPass takes the position param, t, c or b.
+func nodeLabelPositionPass(d *diagram.Diagram, ctx *PassContext) error {
+	position, err := labelPosition(ctx.Params, NODE_LABEL_LOCATION)
+	if err != nil {
+		return err
+	}
+	PositionNodeLabelTo(d, position)
+	return nil
+}
+
+// groupLabelPositionPass takes the position param, t, c or b.
+func groupLabelPositionPass(d *diagram.Diagram, ctx *PassContext) error {
+	position, err := labelPosition(ctx.Params, GRAPH_LABEL_LOCATION)
+	if err != nil {
+		return err
+	}
+	PositionGraphLabelTo(d, position)
+	return nil
+}
+
+func labelPosition(params Params, def string) (string, error) {
+	position, err := params.String("position", def)
+	if err != nil {
+		return "", err
+	}
+	if position != "t" && position != "c" && position != "b" {
+		return "", fmt.Errorf("param position must be t, c or b, got %s", position)
+	}
+	return position, nil
+}
+
+// fontSizesPass takes the group and node params.
+func fontSizesPass(d *diagram.Diagram, ctx *PassContext) error {
+	group, err := ctx.Params.Float("group", 28.0)
+	if err != nil {
+		return err
+	}
+	node, err := ctx.Params.Float("node", 22.0)
+	if err != nil {
+		return err
+	}
+	SetGraphFontsize(d, float32(group), float32(node))
+	return nil
+}
+
+// nodeMarginsPass takes the margin param, in inches.
+func nodeMarginsPass(d *diagram.Diagram, ctx *PassContext) error {
+	margin, err := ctx.Params.Float("margin", 1.5)
+	if err != nil {
+		return err
+	}
+	AddMarginToNodes(d, float32(margin))
+	return nil
+}
+
+// groupMarginsPass takes the base param, in points, multiplied by how many groups nest inside a group.
+func groupMarginsPass(d *diagram.Diagram, ctx *PassContext) error {
+	base, err := ctx.Params.Int("base", 10)
+	if err != nil {
+		return err
+	}
+	SetSubgraphMargins(d, CalculateMaxDepth(d), base)
+	return nil
+}
+
+func hideGroupingEdgesPass(d *diagram.Diagram, ctx *PassContext) error {
+	HideEdgesBetweenSubgraphs(d)
+	return nil
+}
+
+func importantAttributesPass(d *diagram.Diagram, ctx *PassContext) error {
+	if ctx.Handler == nil {
+		return nil
+	}
+	return AddImportantAttributesToLabels(d, ctx.Config, ctx.Handler)
+}
+
+func groupingLabelsPass(d *diagram.Diagram, ctx *PassContext) error {
+	CopyLabelsFromGroupingNodesToSubgraph(d)
+	return nil
+}
+
+func shortLabelsPass(d *diagram.Diagram, ctx *PassContext) error {
+	RemoveResourceTypeFromLabels(d)
+	return nil
+}
+
+func labelTemplatesPass(d *diagram.Diagram, ctx *PassContext) error {
+	ApplyLabelTemplates(d, ctx.Config, ctx.Handler)
+	return nil
+}
+
+func hideGroupingLabelsPass(d *diagram.Diagram, ctx *PassContext) error {
+	HideLabelsFromGroupingNodes(d)
+	return nil
+}
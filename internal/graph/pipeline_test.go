@@ -0,0 +1,98 @@
+package graph
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/CiucurDaniel/terraview/internal/config"
+	"github.com/CiucurDaniel/terraview/internal/diagram"
+)
+
+func TestPipeline(t *testing.T) {
+	steps, err := Pipeline(&config.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(steps) != len(DefaultPipeline) || steps[0].Pass != "graph_attributes" {
+		t.Errorf("unexpected default pipeline %+v", steps)
+	}
+
+	disabled := false
+	steps, err = Pipeline(&config.Config{Pipeline: []config.PipelineStep{
+		{Pass: "node_margins"},
+		{Pass: "short_labels", Enabled: &disabled},
+		{Pass: "graph_attributes"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(steps) != 2 || steps[0].Pass != "node_margins" || steps[1].Pass != "graph_attributes" {
+		t.Errorf("unexpected pipeline %+v", steps)
+	}
+
+	if _, err := Pipeline(&config.Config{Pipeline: []config.PipelineStep{{Pass: "missing"}}}); err == nil {
+		t.Error("expected an error for an unknown pass")
+	}
+}
+
+func TestRunPipeline(t *testing.T) {
+	if err := RegisterPass("test_suffix", func(d *diagram.Diagram, ctx *PassContext) error {
+		suffix, err := ctx.Params.String("suffix", "")
+		for _, node := range d.Instances() {
+			node.Label += suffix
+		}
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterPass("test_suffix", func(d *diagram.Diagram, ctx *PassContext) error { return nil }); err == nil {
+		t.Error("expected an error registering a pass twice")
+	}
+
+	d := newDiagram(t, []string{"azurerm_subnet.web"}, nil)
+	steps := []config.PipelineStep{
+		{Pass: "node_margins", Params: map[string]interface{}{"margin": 0.5}},
+		{Pass: "test_suffix", Params: map[string]interface{}{"suffix": " (web)"}},
+	}
+	var dumped []string
+	err := RunPipeline(d, steps, PassContext{Config: &config.Config{}}, func(pass string, d *diagram.Diagram) error {
+		dumped = append(dumped, pass)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node := d.Node("azurerm_subnet.web")
+	if node.Attrs["margin"] != "0.50" || node.Label != "azurerm_subnet.web (web)" {
+		t.Errorf("params were not applied: %+v", node)
+	}
+	if !reflect.DeepEqual(dumped, []string{"node_margins", "test_suffix"}) {
+		t.Errorf("dumped after %v", dumped)
+	}
+
+	steps = []config.PipelineStep{{Pass: "node_label_position", Params: map[string]interface{}{"position": "left"}}}
+	if err := RunPipeline(d, steps, PassContext{Config: &config.Config{}}, nil); err == nil {
+		t.Error("expected an error for an invalid label position")
+	}
+}
+
+func TestParams(t *testing.T) {
+	params := Params{"margin": 2, "size": "large", "modules": []interface{}{"network", "app"}}
+
+	if margin, err := params.Float("margin", 1.5); err != nil || margin != 2 {
+		t.Errorf("got %v, %v", margin, err)
+	}
+	if margin, err := params.Float("missing", 1.5); err != nil || margin != 1.5 {
+		t.Errorf("got %v, %v", margin, err)
+	}
+	if _, err := params.Int("size", 0); err == nil {
+		t.Error("expected an error for a string given as number")
+	}
+	if modules, err := params.Strings("modules"); err != nil || !reflect.DeepEqual(modules, []string{"network", "app"}) {
+		t.Errorf("got %v, %v", modules, err)
+	}
+	if _, err := params.Strings("size"); err == nil {
+		t.Error("expected an error for a string given as list")
+	}
+}
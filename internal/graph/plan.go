@@ -0,0 +1,169 @@
+package graph
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/CiucurDaniel/terraview/internal/address"
+	"github.com/CiucurDaniel/terraview/internal/diagram"
+	"github.com/CiucurDaniel/terraview/internal/tfplanreader"
+)
+
+// nodeStyle is a set of attributes applied to a node to highlight its state.
+type nodeStyle struct {
+	Style     string
+	FillColor string
+	Color     string
+	FontColor string
+}
+
+// planStyles maps every planned action to a distinct style.
+var planStyles = map[string]nodeStyle{
+	tfplanreader.ActionCreate:  {Style: "filled", FillColor: "#d4f7d4", Color: "#1a7f37", FontColor: "#1a7f37"},
+	tfplanreader.ActionUpdate:  {Style: "filled", FillColor: "#fff4c2", Color: "#9a6700", FontColor: "#9a6700"},
+	tfplanreader.ActionReplace: {Style: "filled,bold", FillColor: "#ffe0c2", Color: "#bc4c00", FontColor: "#bc4c00"},
+	tfplanreader.ActionDelete:  {Style: "filled,dashed", FillColor: "#ffd7d5", Color: "#cf222e", FontColor: "#cf222e"},
+	tfplanreader.ActionRead:    {Style: "filled", FillColor: "#ddf4ff", Color: "#0969da", FontColor: "#0969da"},
+	tfplanreader.ActionNoOp:    {Style: "solid", FillColor: "#ffffff", Color: "#8c959f", FontColor: "#57606a"},
+}
+
+// actionPriority decides which action is shown when several instances share one node.
+var actionPriority = map[string]int{
+	tfplanreader.ActionNoOp:    0,
+	tfplanreader.ActionRead:    1,
+	tfplanreader.ActionUpdate:  2,
+	tfplanreader.ActionCreate:  3,
+	tfplanreader.ActionReplace: 4,
+	tfplanreader.ActionDelete:  5,
+}
+
+// ApplyPlan colors every node according to the action planned for it and adds a legend.
+// Resources which are only in the prior state are added as ghost nodes, since the configuration no longer has them.
+// It must run after PrepareGraphForPrinting as nodes are matched by their address.
+func ApplyPlan(d *diagram.Diagram, plan *tfplanreader.Plan) {
+	nodeActions := make(map[*diagram.Node]string)
+	usedActions := make(map[string]bool)
+
+	for _, change := range plan.ResourceChanges {
+		action := change.Action()
+		if _, known := planStyles[action]; !known {
+			continue
+		}
+
+		nodes := findNodesCovering(d, change.Address)
+		if len(nodes) == 0 {
+			if action != tfplanreader.ActionDelete {
+				continue
+			}
+			nodes = []*diagram.Node{addGhostNode(d, change.Address)}
+		}
+
+		for _, node := range nodes {
+			current, exists := nodeActions[node]
+			if !exists || actionPriority[action] > actionPriority[current] {
+				nodeActions[node] = action
+			}
+		}
+		usedActions[action] = true
+	}
+
+	for node, action := range nodeActions {
+		applyNodeStyle(node, planStyles[action])
+		node.Attrs["tooltip"] = action
+	}
+
+	var legend []string
+	for _, action := range tfplanreader.AllActions {
+		if usedActions[action] {
+			legend = append(legend, action)
+		}
+	}
+	addLegend(d, "Planned actions", legend, planStyles)
+}
+
+// findNodesCovering returns the node of a resource instance. When the graph was not expanded that is the
+// node of the whole resource, found by its module path and resource without instance keys, e.g.
+// module.net.azurerm_subnet.this for module.net[0].azurerm_subnet.this[1]
+func findNodesCovering(d *diagram.Diagram, instance string) []*diagram.Node {
+	if node := d.Node(instance); node != nil {
+		return []*diagram.Node{node}
+	}
+
+	addr, err := address.Parse(instance)
+	if err != nil {
+		return nil
+	}
+	var nodes []*diagram.Node
+	for _, node := range d.Nodes() {
+		if node.Address != nil && node.Address.Covers(addr) {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// addGhostNode adds a node for a resource that is not part of the diagram and returns it.
+// It is put in the cluster of its module and labeled like the other nodes, with the resource name.
+func addGhostNode(d *diagram.Diagram, resource string) *diagram.Node {
+	if node := d.Node(resource); node != nil {
+		return node
+	}
+
+	var group *diagram.Group
+	label := resource
+	if addr, err := address.Parse(resource); err == nil {
+		// Use the cluster of the whole module when the graph was not expanded
+		if unexpanded := addr.WithoutModuleKeys().Module; len(unexpanded) > 0 && d.Group(moduleClusterName(unexpanded)) != nil {
+			group = d.Group(moduleClusterName(unexpanded))
+		} else if len(addr.Module) > 0 {
+			group = ensureModuleCluster(d, addr.Module)
+		}
+		label = addr.Name
+	}
+
+	node, _ := d.AddNode(resource, label, group)
+	node.Attrs["shape"] = "box"
+	node.Attrs["fontsize"] = "22.0"
+	node.Attrs["margin"] = "0.30"
+	return node
+}
+
+// applyNodeStyle sets the attributes of the style on a node.
+func applyNodeStyle(node *diagram.Node, style nodeStyle) {
+	node.Attrs["style"] = style.Style
+	node.Attrs["fillcolor"] = style.FillColor
+	node.Attrs["color"] = style.Color
+	node.Attrs["fontcolor"] = style.FontColor
+}
+
+// addLegend adds a cluster with one styled box per entry explaining what the styles mean.
+func addLegend(d *diagram.Diagram, title string, entries []string, styles map[string]nodeStyle) {
+	if len(entries) == 0 {
+		return
+	}
+
+	id := strings.ReplaceAll(strings.ToLower(title), " ", "_")
+	legend, err := d.AddGroup("cluster_legend_"+id, diagram.GroupOther, title, nil)
+	if err != nil {
+		return
+	}
+	legend.Attrs["fontsize"] = "28.0"
+	legend.Attrs["labelloc"] = "t"
+
+	var previous *diagram.Node
+	for _, entry := range entries {
+		node, err := d.AddNode(fmt.Sprintf("legend_%s_%s", id, entry), entry, legend)
+		if err != nil {
+			continue
+		}
+		node.Attrs["shape"] = "box"
+		node.Attrs["fontsize"] = "22.0"
+		applyNodeStyle(node, styles[entry])
+
+		// Invisible edges keep the legend entries stacked in order
+		if previous != nil {
+			d.AddEdge(previous, node, diagram.EdgeDependency).Hidden = true
+		}
+		previous = node
+	}
+}
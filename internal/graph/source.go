@@ -0,0 +1,152 @@
+package graph
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf16"
+
+	"github.com/CiucurDaniel/terraview/internal/tfconfigreader"
+	"github.com/CiucurDaniel/terraview/internal/tfstatereader"
+	"github.com/awalterschulze/gographviz"
+)
+
+// GraphSource provides the dependency graph which PrepareGraphForPrinting turns into a diagram.
+type GraphSource interface {
+	// Graph returns the graph in the shape produced by "terraform graph".
+	Graph() (*gographviz.Graph, error)
+}
+
+// TerraformSource obtains the graph by running "terraform graph" in Dir.
+type TerraformSource struct {
+	Dir string
+}
+
+// Graph implements GraphSource.
+func (s *TerraformSource) Graph() (*gographviz.Graph, error) {
+	return ObtainGraph(s.Dir)
+}
+
+// ModuleInterface implements ModuleInterfaceProvider.
+func (s *TerraformSource) ModuleInterface(modulePath string) ([]string, []string, bool) {
+	return moduleInterface(s.Dir, modulePath)
+}
+
+// ConfigSource builds the graph by parsing the Terraform files in Dir.
+type ConfigSource struct {
+	Dir string
+}
+
+// Graph implements GraphSource.
+func (s *ConfigSource) Graph() (*gographviz.Graph, error) {
+	return ObtainGraphFromConfig(s.Dir)
+}
+
+// ModuleInterface implements ModuleInterfaceProvider.
+func (s *ConfigSource) ModuleInterface(modulePath string) ([]string, []string, bool) {
+	return moduleInterface(s.Dir, modulePath)
+}
+
+// moduleInterface reads the configuration in dirPath and returns the inputs and outputs of a module call.
+func moduleInterface(dirPath, modulePath string) ([]string, []string, bool) {
+	root, err := tfconfigreader.LoadModule(dirPath)
+	if err != nil {
+		return nil, nil, false
+	}
+	return tfconfigreader.Interface(root, modulePath)
+}
+
+// FileSource reads a graph previously generated with "terraform graph > plan.dot".
+type FileSource struct {
+	Path string
+}
+
+// Graph implements GraphSource.
+func (s *FileSource) Graph() (*gographviz.Graph, error) {
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading graph file %s: %v", s.Path, err)
+	}
+
+	return ParseGraph(data)
+}
+
+// ReaderSource reads a DOT graph from Reader, typically os.Stdin.
+type ReaderSource struct {
+	Reader io.Reader
+}
+
+// Graph implements GraphSource.
+func (s *ReaderSource) Graph() (*gographviz.Graph, error) {
+	data, err := io.ReadAll(s.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("error reading graph: %v", err)
+	}
+
+	return ParseGraph(data)
+}
+
+// StateSource builds the graph from the resources and dependencies recorded in a Terraform state,
+// so no configuration is needed to draw a live environment.
+type StateSource struct {
+	Handler *tfstatereader.TFStateHandler
+}
+
+// Graph implements GraphSource.
+func (s *StateSource) Graph() (*gographviz.Graph, error) {
+	if s.Handler == nil {
+		return nil, fmt.Errorf("no terraform state available to build the graph from")
+	}
+
+	graph, err := s.Handler.BuildGraph()
+	if err != nil {
+		return nil, fmt.Errorf("error building graph from Terraform state: %v", err)
+	}
+
+	return graph, nil
+}
+
+// ParseGraph parses DOT data into a graph. Files written by PowerShell redirection are
+// UTF-16 encoded, so a byte order mark is honoured before parsing.
+func ParseGraph(data []byte) (*gographviz.Graph, error) {
+	graphData := decodeText(data)
+
+	// Parse string into AST
+	graphAst, err := gographviz.ParseString(graphData)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing Terraform graph data: %v", err)
+	}
+
+	// Create a new graph object
+	graph := gographviz.NewGraph()
+
+	// Analyze and populate the graph object
+	err = gographviz.Analyse(graphAst, graph)
+	if err != nil {
+		return nil, fmt.Errorf("error analyzing Terraform graph data: %v", err)
+	}
+
+	return graph, nil
+}
+
+// decodeText converts UTF-8 or BOM prefixed UTF-16 data to a string.
+func decodeText(data []byte) string {
+	var order binary.ByteOrder
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		order = binary.LittleEndian
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		order = binary.BigEndian
+	default:
+		return string(bytes.TrimPrefix(data, []byte{0xEF, 0xBB, 0xBF}))
+	}
+
+	data = data[2:]
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = order.Uint16(data[2*i:])
+	}
+	return string(utf16.Decode(units))
+}
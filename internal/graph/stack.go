@@ -0,0 +1,125 @@
+package graph
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/CiucurDaniel/terraview/internal/address"
+	"github.com/CiucurDaniel/terraview/internal/config"
+	"github.com/CiucurDaniel/terraview/internal/diagram"
+	"github.com/CiucurDaniel/terraview/internal/tfstatereader"
+)
+
+// StackInstances replaces the instances of a resource with a single stacked node when there are more of them
+// than the threshold configured for the resource type, e.g. vm[0] to vm[9] with vm. Instances of every module
+// instance are stacked separately. The stacked node is labeled with a ×N badge, lists the keys in its tooltip
+// and takes over the edges of the instances, once per node it connects to.
+func StackInstances(d *diagram.Diagram, cfg *config.Config) {
+	// Find the stacked node every instance is replaced with
+	replacement := make(map[*diagram.Node]*diagram.Node)
+	for _, resource := range d.Resources() {
+		threshold := cfg.StackThresholdFor(resource.Address.Type)
+		if threshold <= 0 {
+			continue
+		}
+
+		stacks := make(map[string][]*diagram.Node)
+		for _, node := range resource.Instances {
+			if node.Address.Key != "" {
+				id := node.Address.WithoutKey().String()
+				stacks[id] = append(stacks[id], node)
+			}
+		}
+		for _, id := range address.SortedKeys(stacks) {
+			instances := stacks[id]
+			if len(instances) <= threshold {
+				continue
+			}
+			stack, err := addStackedNode(d, id, instances)
+			if err != nil {
+				log.Printf("error stacking the instances of %s: %v", id, err)
+				continue
+			}
+			for _, instance := range instances {
+				replacement[instance] = stack
+			}
+		}
+	}
+	if len(replacement) == 0 {
+		return
+	}
+
+	// Move the edges to the stacked nodes, dropping the ones between instances of a stack and duplicates
+	for _, edge := range d.Edges() {
+		from, to := edge.From, edge.To
+		if stack, ok := replacement[from]; ok {
+			from = stack
+		}
+		if stack, ok := replacement[to]; ok {
+			to = stack
+		}
+		if from == edge.From && to == edge.To {
+			continue
+		}
+
+		d.RemoveEdge(edge)
+		if from != to && !CheckEdgeExistence(from, to, d) {
+			d.CopyEdge(edge, from, to)
+		}
+	}
+
+	for instance := range replacement {
+		d.RemoveNode(instance)
+	}
+}
+
+// addStackedNode adds the node standing for the instances, looking like the first of them.
+func addStackedNode(d *diagram.Diagram, id string, instances []*diagram.Node) (*diagram.Node, error) {
+	first := instances[0]
+	stack, err := d.AddNode(id, fmt.Sprintf("%s\n×%d", id, len(instances)), first.Group)
+	if err != nil {
+		return nil, err
+	}
+	stack.Icon = first.Icon
+	for key, value := range first.Attrs {
+		stack.Attrs[key] = value
+	}
+
+	keys := make([]string, len(instances))
+	for i, instance := range instances {
+		stack.Stacked = append(stack.Stacked, instance.ID)
+		keys[i] = strings.Trim(instance.Address.Key, `"`)
+	}
+	stack.Attrs["tooltip"] = "keys: " + strings.Join(keys, ", ")
+	return stack, nil
+}
+
+// summariseAttributes formats the important attributes of the instances of a stacked node, with the distinct
+// values of every attribute across the instances, e.g. size: Standard_B1s, Standard_B2s
+func summariseAttributes(node *diagram.Node, cfg *config.Config, handler *tfstatereader.TFStateHandler) []string {
+	var summary []string
+	for _, attr := range cfg.AttributesFor(node.Address.Type) {
+		var values []string
+		for _, instance := range node.Stacked {
+			attributes, err := handler.GetAttributes(instance)
+			if err != nil {
+				continue
+			}
+			found, err := tfstatereader.EvaluatePath(attributes, attr)
+			if err != nil {
+				log.Printf("Invalid attribute %s: %v", attr, err)
+				break
+			}
+			for _, value := range found {
+				if text := tfstatereader.FormatValue(value); text != "" && !address.Contains(values, text) {
+					values = append(values, text)
+				}
+			}
+		}
+		if len(values) > 0 {
+			summary = append(summary, fmt.Sprintf("%s: %s", attr, strings.Join(values, ", ")))
+		}
+	}
+	return summary
+}
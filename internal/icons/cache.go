@@ -0,0 +1,304 @@
+package icons
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultCacheTTL is how long a downloaded icon is used before it is revalidated with the server.
+const DefaultCacheTTL = 7 * 24 * time.Hour
+
+// Cache stores downloaded icons on disk so they are shared across runs. Icons are stored by the
+// SHA-256 of their content in blobs/, and entries/ maps every URL to its blob and HTTP validators.
+type Cache struct {
+	Dir string
+	TTL time.Duration
+}
+
+// CacheEntry describes a cached download.
+type CacheEntry struct {
+	URL          string    `json:"url"`
+	SHA256       string    `json:"sha256"`
+	Size         int       `json:"size"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	FetchedAt    time.Time `json:"fetched_at"`
+}
+
+// DefaultCacheDir returns $XDG_CACHE_HOME/terraview/icons, using the platform's user cache directory
+// when XDG_CACHE_HOME is not set.
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("could not find a cache directory: %v", err)
+	}
+	return filepath.Join(dir, "terraview", "icons"), nil
+}
+
+// ExpandHome replaces a leading ~ in a path with the home directory of the user.
+func ExpandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") && !strings.HasPrefix(path, `~\`) {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("could not expand %s: %v", path, err)
+	}
+	return filepath.Join(home, path[1:]), nil
+}
+
+// NewCache creates a cache in dir, using DefaultCacheTTL when ttl is zero.
+func NewCache(dir string, ttl time.Duration) *Cache {
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+	return &Cache{Dir: dir, TTL: ttl}
+}
+
+// Expired checks if an entry has to be revalidated.
+func (c *Cache) Expired(entry CacheEntry) bool {
+	return time.Since(entry.FetchedAt) > c.TTL
+}
+
+// Fetch returns the icon at url, downloading it only when it is not cached or its entry expired.
+// Expired entries are revalidated with their ETag and Last-Modified, and used as they are when the
+// server can not be reached or fails.
+func (c *Cache) Fetch(client *http.Client, url string) ([]byte, error) {
+	entry, cached := c.entry(url)
+	var data []byte
+	if cached {
+		var err error
+		data, err = c.blob(entry)
+		if err != nil {
+			cached = false
+		} else if !c.Expired(entry) {
+			return data, nil
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if cached {
+		if entry.ETag != "" {
+			req.Header.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			req.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		if cached {
+			return data, nil
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if cached && resp.StatusCode == http.StatusNotModified {
+		entry.FetchedAt = time.Now()
+		return data, c.writeEntry(entry)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if cached && resp.StatusCode >= http.StatusInternalServerError {
+			return data, nil
+		}
+		return nil, statusError(resp, url)
+	}
+
+	data, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, fmt.Errorf("%s is not a PNG image", url)
+	}
+
+	entry = CacheEntry{
+		URL:          url,
+		SHA256:       checksum(data),
+		Size:         len(data),
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		FetchedAt:    time.Now(),
+	}
+	if err := writeFileAtomic(c.blobPath(entry.SHA256), data); err != nil {
+		return nil, fmt.Errorf("could not cache %s: %v", url, err)
+	}
+	return data, c.writeEntry(entry)
+}
+
+// Entries returns all cache entries sorted by URL.
+func (c *Cache) Entries() ([]CacheEntry, error) {
+	files, err := os.ReadDir(filepath.Join(c.Dir, "entries"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []CacheEntry
+	for _, file := range files {
+		entry, err := readEntry(filepath.Join(c.Dir, "entries", file.Name()))
+		if err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].URL < entries[j].URL })
+	return entries, nil
+}
+
+// Verify checks the blob of every entry against its checksum. Entries whose blob is missing or corrupt
+// are removed so they are downloaded again, and returned.
+func (c *Cache) Verify() ([]CacheEntry, error) {
+	entries, err := c.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	var broken []CacheEntry
+	for _, entry := range entries {
+		if _, err := c.blob(entry); err == nil {
+			continue
+		}
+		broken = append(broken, entry)
+		os.Remove(c.entryPath(entry.URL))
+		os.Remove(c.blobPath(entry.SHA256))
+	}
+	return broken, nil
+}
+
+// Purge removes the expired entries, or all of them, and the blobs no entry refers to anymore.
+// It returns the number of removed entries.
+func (c *Cache) Purge(expiredOnly bool) (int, error) {
+	// Only what the cache wrote is removed, the directory itself is configured by the user
+	if !expiredOnly {
+		entries, err := c.Entries()
+		if err != nil {
+			return 0, err
+		}
+		for _, dir := range []string{"entries", "blobs"} {
+			if err := os.RemoveAll(filepath.Join(c.Dir, dir)); err != nil {
+				return 0, err
+			}
+		}
+		return len(entries), nil
+	}
+
+	entries, err := c.Entries()
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	used := make(map[string]bool)
+	for _, entry := range entries {
+		if c.Expired(entry) {
+			if err := os.Remove(c.entryPath(entry.URL)); err != nil {
+				return removed, err
+			}
+			removed++
+			continue
+		}
+		used[entry.SHA256] = true
+	}
+
+	blobs, err := os.ReadDir(filepath.Join(c.Dir, "blobs"))
+	if err != nil && !os.IsNotExist(err) {
+		return removed, err
+	}
+	for _, blob := range blobs {
+		if !used[blob.Name()] {
+			os.Remove(filepath.Join(c.Dir, "blobs", blob.Name()))
+		}
+	}
+	return removed, nil
+}
+
+// entry returns the cache entry of url, if any.
+func (c *Cache) entry(url string) (CacheEntry, bool) {
+	entry, err := readEntry(c.entryPath(url))
+	if err != nil || entry.URL != url {
+		return CacheEntry{}, false
+	}
+	return entry, true
+}
+
+// blob reads the icon of an entry and checks it against the entry's checksum.
+func (c *Cache) blob(entry CacheEntry) ([]byte, error) {
+	data, err := os.ReadFile(c.blobPath(entry.SHA256))
+	if err != nil {
+		return nil, err
+	}
+	if checksum(data) != entry.SHA256 {
+		return nil, fmt.Errorf("checksum mismatch for %s", entry.URL)
+	}
+	return data, nil
+}
+
+func (c *Cache) writeEntry(entry CacheEntry) error {
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(c.entryPath(entry.URL), data)
+}
+
+func (c *Cache) entryPath(url string) string {
+	return filepath.Join(c.Dir, "entries", checksum([]byte(url))+".json")
+}
+
+func (c *Cache) blobPath(sum string) string {
+	return filepath.Join(c.Dir, "blobs", sum)
+}
+
+func readEntry(path string) (CacheEntry, error) {
+	var entry CacheEntry
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return entry, err
+	}
+	err = json.Unmarshal(data, &entry)
+	return entry, err
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// writeFileAtomic writes through a temporary file, so concurrent runs never see a partial file.
+func writeFileAtomic(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
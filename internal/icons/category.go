@@ -0,0 +1,50 @@
+package icons
+
+import "strings"
+
+// Categories are the resource categories which have a fallback icon.
+var Categories = []string{"compute", "network", "storage", "database"}
+
+// DefaultCategory names the fallback icon of resources which are in none of the Categories.
+const DefaultCategory = "default"
+
+// categoryKeywords maps words found in resource types to their category. Database is checked first
+// since database types often also mention servers or storage, e.g. azurerm_mssql_server
+var categoryKeywords = []struct {
+	Category string
+	Keywords []string
+}{
+	{"database", []string{"sql", "mssql", "database", "db", "cosmos", "cosmosdb", "redis", "postgres", "postgresql", "mysql", "dynamodb", "mariadb", "rds", "spanner", "bigtable", "firestore", "elasticache", "cache"}},
+	{"storage", []string{"storage", "bucket", "s3", "disk", "blob", "share", "volume", "ebs", "efs", "backup", "filestore"}},
+	{"network", []string{"network", "subnet", "vnet", "vpc", "lb", "load_balancer", "nat", "gateway", "route", "dns", "firewall", "security_group", "ip", "eip", "peering", "endpoint", "cdn", "frontdoor", "interface"}},
+	{"compute", []string{"virtual_machine", "vm", "instance", "compute", "function", "lambda", "app_service", "web_app", "container", "kubernetes", "aks", "eks", "gke", "ecs", "batch", "autoscaling", "scale_set"}},
+}
+
+// Category returns the category of a resource type, or an empty string if it has none.
+func Category(resourceType string) string {
+	parts := strings.Split(resourceType, "_")
+	if len(parts) > 1 {
+		// Skip the provider, e.g. the google in google_compute_instance
+		parts = parts[1:]
+	}
+	name := "_" + strings.Join(parts, "_") + "_"
+
+	for _, category := range categoryKeywords {
+		for _, keyword := range category.Keywords {
+			if strings.Contains(name, "_"+keyword+"_") {
+				return category.Category
+			}
+		}
+	}
+	return ""
+}
+
+// isCategory checks if name is one of the Categories.
+func isCategory(name string) bool {
+	for _, category := range Categories {
+		if category == name {
+			return true
+		}
+	}
+	return false
+}
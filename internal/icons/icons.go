@@ -0,0 +1,26 @@
+// Package icons bundles the resource icons into the binary, so diagrams can be rendered offline.
+// Icons live in one directory per provider and are named after the resource type, e.g. azurerm/azurerm_subnet.png
+package icons
+
+import (
+	"embed"
+	"path"
+	"strings"
+)
+
+//go:embed */*.png
+var files embed.FS
+
+// Provider returns the provider a resource type belongs to, e.g. azurerm for azurerm_subnet
+func Provider(resourceType string) string {
+	return strings.SplitN(resourceType, "_", 2)[0]
+}
+
+// Lookup returns the bundled PNG icon of a resource type.
+func Lookup(resourceType string) ([]byte, bool) {
+	data, err := files.ReadFile(path.Join(Provider(resourceType), resourceType+".png"))
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
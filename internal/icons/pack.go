@@ -0,0 +1,278 @@
+package icons
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CiucurDaniel/terraview/internal/config"
+)
+
+// errNotFound is returned when a server does not have an icon.
+var errNotFound = errors.New("icon not found")
+
+// pngSignature starts every PNG file, it tells icons apart from error pages served with a 200 status.
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// MaxParallelFetches bounds the number of icons resolved at the same time.
+const MaxParallelFetches = 8
+
+// Pack finds the icon of a resource type in the configured sources.
+type Pack struct {
+	Sources   []config.IconSource
+	Overrides map[string]string
+	Fallbacks map[string]string
+	Cache     *Cache // downloads are not cached when nil
+	client    *http.Client
+}
+
+// NewPack creates a pack from the icon configuration.
+func NewPack(cfg *config.Config) (*Pack, error) {
+	sources := cfg.IconSources()
+	for i, source := range sources {
+		set := 0
+		for _, isSet := range []bool{source.Dir != "", source.URL != "", source.Embedded} {
+			if isSet {
+				set++
+			}
+		}
+		if set != 1 {
+			return nil, fmt.Errorf("icon source %d must set exactly one of dir, url or embedded", i+1)
+		}
+		if source.URL != "" && !strings.Contains(source.URL, "{type}") {
+			return nil, fmt.Errorf("icon url %s must contain the {type} placeholder", source.URL)
+		}
+	}
+	for category := range cfg.Icons.Fallbacks {
+		if !isCategory(category) && category != DefaultCategory {
+			return nil, fmt.Errorf("unknown icon category %s, expected one of %s or %s", category, strings.Join(Categories, ", "), DefaultCategory)
+		}
+	}
+
+	cache, err := NewCacheFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	pack := &Pack{
+		Sources:   sources,
+		Overrides: cfg.Icons.Overrides,
+		Fallbacks: cfg.Icons.Fallbacks,
+		Cache:     cache,
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}
+	if cache == nil && pack.downloads() {
+		fmt.Fprintln(os.Stderr, "WARNING: No cache directory found, downloaded icons will not be cached")
+	}
+	return pack, nil
+}
+
+// NewCacheFromConfig creates the icon cache configured in cfg. A leading ~ in cache_dir is the home directory.
+// It returns nil without a usable cache directory, icons are then downloaded on every run.
+func NewCacheFromConfig(cfg *config.Config) (*Cache, error) {
+	var ttl time.Duration
+	if cfg.Icons.CacheTTL != "" {
+		var err error
+		ttl, err = time.ParseDuration(cfg.Icons.CacheTTL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid icon cache_ttl %s: %v", cfg.Icons.CacheTTL, err)
+		}
+	}
+
+	dir, err := ExpandHome(cfg.Icons.CacheDir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid icon cache_dir: %v", err)
+	}
+	if dir == "" {
+		dir, err = DefaultCacheDir()
+		if err != nil {
+			return nil, nil
+		}
+	}
+	return NewCache(dir, ttl), nil
+}
+
+// downloads checks if the pack may download icons, from a URL source, override or fallback.
+func (p *Pack) downloads() bool {
+	for _, source := range p.Sources {
+		if source.URL != "" {
+			return true
+		}
+	}
+	for _, locations := range []map[string]string{p.Overrides, p.Fallbacks} {
+		for _, location := range locations {
+			if isRemote(location) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Resolve looks the icons of several resource types up in parallel, using at most MaxParallelFetches
+// workers. Types without an icon are left out of the result.
+func (p *Pack) Resolve(resourceTypes []string) map[string][]byte {
+	jobs := make(chan string)
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	result := make(map[string][]byte)
+
+	workers := MaxParallelFetches
+	if len(resourceTypes) < workers {
+		workers = len(resourceTypes)
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for resourceType := range jobs {
+				if data, ok := p.Icon(resourceType); ok {
+					mutex.Lock()
+					result[resourceType] = data
+					mutex.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, resourceType := range resourceTypes {
+		jobs <- resourceType
+	}
+	close(jobs)
+	wg.Wait()
+
+	return result
+}
+
+// Icon returns the PNG icon of a resource type: the override for the type, the first source having it,
+// or the fallback of the type's category, which is the default icon for types without a category.
+func (p *Pack) Icon(resourceType string) ([]byte, bool) {
+	if location, ok := p.Overrides[resourceType]; ok {
+		data, err := p.load(location)
+		if err == nil {
+			return data, true
+		}
+		fmt.Fprintf(os.Stderr, "WARNING: Could not load icon override for %s: %v\n", resourceType, err)
+	}
+
+	for _, source := range p.Sources {
+		if data, ok := p.fromSource(source, resourceType); ok {
+			return data, true
+		}
+	}
+
+	// Resources without a category, like those of unknown providers, get the default icon
+	category := Category(resourceType)
+	if category == "" {
+		category = DefaultCategory
+	}
+	if location, ok := p.Fallbacks[category]; ok {
+		data, err := p.load(location)
+		if err == nil {
+			return data, true
+		}
+		fmt.Fprintf(os.Stderr, "WARNING: Could not load %s fallback icon: %v\n", category, err)
+	}
+	data, err := files.ReadFile("generic/" + category + ".png")
+	return data, err == nil
+}
+
+// fromSource looks the icon of a resource type up in a single source.
+func (p *Pack) fromSource(source config.IconSource, resourceType string) ([]byte, bool) {
+	provider := Provider(resourceType)
+
+	switch {
+	case source.Embedded:
+		return Lookup(resourceType)
+	case source.Dir != "":
+		for _, path := range []string{
+			filepath.Join(source.Dir, provider, resourceType+".png"),
+			filepath.Join(source.Dir, resourceType+".png"),
+		} {
+			if data, err := readPNG(path); err == nil {
+				return data, true
+			}
+		}
+	case source.URL != "":
+		url := strings.NewReplacer("{provider}", provider, "{type}", resourceType).Replace(source.URL)
+		data, err := p.download(url)
+		if err == nil {
+			return data, true
+		}
+		// A missing icon is expected, the next source may have it
+		if !errors.Is(err, errNotFound) {
+			fmt.Fprintln(os.Stderr, "Error downloading image:", err)
+		}
+	}
+	return nil, false
+}
+
+// load reads an icon from a file or, for http(s) locations, downloads it.
+func (p *Pack) load(location string) ([]byte, error) {
+	if isRemote(location) {
+		return p.download(location)
+	}
+	return readPNG(location)
+}
+
+// isRemote checks if an icon location is a URL.
+func isRemote(location string) bool {
+	return strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://")
+}
+
+// download fetches an icon, rejecting failed requests and responses which are not PNG images.
+func (p *Pack) download(url string) ([]byte, error) {
+	client := p.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if p.Cache != nil {
+		return p.Cache.Fetch(client, url)
+	}
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp, url)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, fmt.Errorf("%s is not a PNG image", url)
+	}
+	return data, nil
+}
+
+// statusError describes a response other than 200 OK, wrapping errNotFound for 404.
+func statusError(resp *http.Response, url string) error {
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("%w at %s", errNotFound, url)
+	}
+	return fmt.Errorf("unexpected status %s for %s", resp.Status, url)
+}
+
+// readPNG reads an icon from disk.
+func readPNG(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, fmt.Errorf("%s is not a PNG image", path)
+	}
+	return data, nil
+}
@@ -0,0 +1,59 @@
+package icons
+
+// azureImage, aws and gcp build the draw.io styles of the stencil libraries of each cloud.
+func azureImage(path string) string {
+	return "image;aspect=fixed;points=[];image=img/lib/azure2/" + path + ";"
+}
+
+func aws(icon, color string) string {
+	return "sketch=0;outlineConnect=0;aspect=fixed;strokeColor=#ffffff;fillColor=" + color +
+		";shape=mxgraph.aws4.resourceIcon;resIcon=mxgraph.aws4." + icon + ";"
+}
+
+func gcp(icon string) string {
+	return "sketch=0;aspect=fixed;fillColor=#5184F3;strokeColor=none;shape=mxgraph.gcp2.hexIcon;prIcon=" + icon + ";"
+}
+
+// stencils maps resource types to the style of the matching shape of the draw.io Azure, AWS and GCP libraries.
+var stencils = map[string]string{
+	"azurerm_resource_group":          azureImage("general/Resource_Groups.svg"),
+	"azurerm_virtual_network":         azureImage("networking/Virtual_Networks.svg"),
+	"azurerm_subnet":                  azureImage("networking/Subnet.svg"),
+	"azurerm_network_interface":       azureImage("networking/Network_Interfaces.svg"),
+	"azurerm_network_security_group":  azureImage("networking/Network_Security_Groups.svg"),
+	"azurerm_public_ip":               azureImage("networking/Public_IP_Addresses.svg"),
+	"azurerm_lb":                      azureImage("networking/Load_Balancers.svg"),
+	"azurerm_application_gateway":     azureImage("networking/Application_Gateways.svg"),
+	"azurerm_firewall":                azureImage("networking/Firewalls.svg"),
+	"azurerm_dns_zone":                azureImage("networking/DNS_Zones.svg"),
+	"azurerm_linux_virtual_machine":   azureImage("compute/Virtual_Machine.svg"),
+	"azurerm_windows_virtual_machine": azureImage("compute/Virtual_Machine.svg"),
+	"azurerm_virtual_machine":         azureImage("compute/Virtual_Machine.svg"),
+	"azurerm_kubernetes_cluster":      azureImage("containers/Kubernetes_Services.svg"),
+	"azurerm_storage_account":         azureImage("storage/Storage_Accounts.svg"),
+	"azurerm_mssql_server":            azureImage("databases/SQL_Server.svg"),
+	"azurerm_mssql_database":          azureImage("databases/SQL_Database.svg"),
+	"azurerm_key_vault":               azureImage("security/Key_Vaults.svg"),
+
+	"aws_instance":        aws("ec2", "#ED7100"),
+	"aws_lambda_function": aws("lambda", "#ED7100"),
+	"aws_lb":              aws("elastic_load_balancing", "#8C4FFF"),
+	"aws_vpc":             aws("vpc", "#8C4FFF"),
+	"aws_route53_zone":    aws("route_53", "#8C4FFF"),
+	"aws_s3_bucket":       aws("s3", "#7AA116"),
+	"aws_db_instance":     aws("rds", "#C925D1"),
+	"aws_dynamodb_table":  aws("dynamodb", "#C925D1"),
+
+	"google_compute_instance":      gcp("compute_engine"),
+	"google_compute_network":       gcp("virtual_private_cloud"),
+	"google_compute_firewall":      gcp("cloud_firewall_rules"),
+	"google_storage_bucket":        gcp("cloud_storage"),
+	"google_sql_database_instance": gcp("cloud_sql"),
+	"google_container_cluster":     gcp("container_engine"),
+}
+
+// Stencil returns the draw.io style of the shape for a resource type.
+func Stencil(resourceType string) (string, bool) {
+	style, ok := stencils[resourceType]
+	return style, ok
+}
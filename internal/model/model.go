@@ -0,0 +1,441 @@
+// Package model holds the processed diagram in a form other tools can read and write: resources with their
+// state, the groups they are drawn in and the edges between them. schema.json documents the JSON encoding.
+package model
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/CiucurDaniel/terraview/internal/address"
+	"github.com/awalterschulze/gographviz"
+)
+
+// Version is the version of the schema written, increased on changes older readers can not handle.
+const Version = 1
+
+// EdgeDependency is the type of the edges read from the dependency graph.
+const EdgeDependency = "dependency"
+
+// Model is a processed diagram, ready to be rendered.
+type Model struct {
+	Version   int               `json:"version"`
+	Name      string            `json:"name"`
+	Style     map[string]string `json:"style,omitempty"`
+	Resources []Resource        `json:"resources"`
+	Nodes     []Node            `json:"nodes,omitempty"`
+	Groups    []Group           `json:"groups"`
+	Edges     []Edge            `json:"edges"`
+	Icons     map[string]string `json:"icons,omitempty"`
+}
+
+// Resource is a node standing for a resource or one of its instances.
+type Resource struct {
+	ID           string                 `json:"id"`
+	Address      string                 `json:"address"`
+	Mode         string                 `json:"mode"`
+	Type         string                 `json:"type"`
+	Name         string                 `json:"name"`
+	ModulePath   string                 `json:"module_path,omitempty"`
+	Index        interface{}            `json:"index,omitempty"`
+	Provider     string                 `json:"provider,omitempty"`
+	Dependencies []string               `json:"dependencies,omitempty"`
+	Attributes   map[string]interface{} `json:"attributes,omitempty"`
+	Icon         string                 `json:"icon,omitempty"`
+	Label        string                 `json:"label"`
+	Group        string                 `json:"group,omitempty"`
+	Style        map[string]string      `json:"style,omitempty"`
+}
+
+// Node is any other node of the diagram, like a variable, a collapsed module or a legend entry.
+type Node struct {
+	ID    string            `json:"id"`
+	Label string            `json:"label"`
+	Group string            `json:"group,omitempty"`
+	Style map[string]string `json:"style,omitempty"`
+}
+
+// Group is a box drawn around resources: a module instance, a grouping resource like a subnet, or another cluster.
+// Groups nest through their parent.
+type Group struct {
+	ID      string            `json:"id"`
+	Kind    string            `json:"kind"`
+	Address string            `json:"address,omitempty"`
+	Label   string            `json:"label"`
+	Parent  string            `json:"parent,omitempty"`
+	Style   map[string]string `json:"style,omitempty"`
+}
+
+// Edge connects two nodes, pointing from a resource to what it depends on.
+type Edge struct {
+	From  string            `json:"from"`
+	To    string            `json:"to"`
+	Type  string            `json:"type"`
+	Label string            `json:"label,omitempty"`
+	Style map[string]string `json:"style,omitempty"`
+}
+
+// Details is what the state records about a resource instance, beyond what is drawn.
+type Details struct {
+	Address      string                 `json:"address"`
+	Provider     string                 `json:"provider,omitempty"`
+	Dependencies []string               `json:"dependencies,omitempty"`
+	Attributes   map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// Kinds of groups
+const (
+	GroupModule   = "module"
+	GroupResource = "resource"
+	GroupOther    = "other"
+)
+
+// Attributes moved into fields of the model, or only meaningful while rendering
+var ownAttributes = map[string]bool{"label": true, "image": true, "id": true, "imagepath": true}
+
+// typeAttribute is the DOT attribute holding the type of an edge, Graphviz ignores comments
+const typeAttribute = "comment"
+
+// FromGraph builds the model of a prepared graph. details, keyed by node name, add what the state records about
+// the resources and may be nil. Icons are read from the image path of the graph and embedded.
+func FromGraph(graph *gographviz.Graph, details map[string]Details) (*Model, error) {
+	m := &Model{
+		Version:   Version,
+		Name:      graph.Name,
+		Style:     style(graph.Attrs),
+		Resources: []Resource{},
+		Groups:    []Group{},
+		Edges:     []Edge{},
+		Icons:     make(map[string]string),
+	}
+	imageDir := address.Unquote(graph.Attrs["imagepath"])
+
+	for _, name := range address.SortedKeys(graph.SubGraphs.SubGraphs) {
+		subgraph := graph.SubGraphs.SubGraphs[name]
+		group := Group{
+			ID:     address.Unquote(name),
+			Kind:   GroupOther,
+			Label:  label(subgraph.Attrs["label"]),
+			Parent: parent(graph, name),
+			Style:  style(subgraph.Attrs),
+		}
+		inner := strings.TrimPrefix(group.ID, "cluster_")
+		if addr, err := address.Parse(inner); err == nil && strings.HasPrefix(group.ID, "cluster_") {
+			group.Address = inner
+			group.Kind = GroupResource
+			if addr.IsModuleCall() {
+				group.Kind = GroupModule
+			}
+		}
+		m.Groups = append(m.Groups, group)
+	}
+
+	for _, node := range graph.Nodes.Sorted() {
+		id := address.Unquote(node.Name)
+		addr, err := address.Parse(id)
+		if err != nil || addr.IsModuleCall() {
+			m.Nodes = append(m.Nodes, Node{
+				ID:    id,
+				Label: nodeLabel(node),
+				Group: parent(graph, node.Name),
+				Style: style(node.Attrs),
+			})
+			continue
+		}
+
+		resource := Resource{
+			ID:         id,
+			Address:    addr.String(),
+			Mode:       addr.Mode,
+			Type:       addr.Type,
+			Name:       addr.Name,
+			ModulePath: addr.ModulePath(),
+			Label:      nodeLabel(node),
+			Group:      parent(graph, node.Name),
+			Style:      style(node.Attrs),
+		}
+		if addr.Key != "" {
+			if err := json.Unmarshal([]byte(addr.Key), &resource.Index); err != nil {
+				return nil, fmt.Errorf("invalid instance key of %s: %v", id, err)
+			}
+		}
+		if nodeDetails, ok := details[node.Name]; ok {
+			resource.Provider = nodeDetails.Provider
+			resource.Dependencies = nodeDetails.Dependencies
+			resource.Attributes = nodeDetails.Attributes
+		}
+		if image := address.Unquote(node.Attrs["image"]); image != "" {
+			resource.Icon = image
+			if _, done := m.Icons[image]; !done {
+				if data, err := os.ReadFile(filepath.Join(imageDir, image)); err == nil {
+					m.Icons[image] = "data:" + http.DetectContentType(data) + ";base64," + base64.StdEncoding.EncodeToString(data)
+				}
+			}
+		}
+		m.Resources = append(m.Resources, resource)
+	}
+
+	for _, edge := range graph.Edges.Sorted() {
+		edgeType := address.Unquote(edge.Attrs[typeAttribute])
+		if edgeType == "" {
+			edgeType = EdgeDependency
+		}
+		edgeStyle := style(edge.Attrs)
+		delete(edgeStyle, typeAttribute)
+		if len(edgeStyle) == 0 {
+			edgeStyle = nil
+		}
+		m.Edges = append(m.Edges, Edge{
+			From:  address.Unquote(edge.Src),
+			To:    address.Unquote(edge.Dst),
+			Type:  edgeType,
+			Label: label(edge.Attrs["label"]),
+			Style: edgeStyle,
+		})
+	}
+
+	return m, nil
+}
+
+// Graph converts the model back into a graph. The icons are written into imageDir, which becomes the image path.
+func (m *Model) Graph(imageDir string) (*gographviz.Graph, error) {
+	if m.Version != Version {
+		return nil, fmt.Errorf("unsupported model version %d, expected %d", m.Version, Version)
+	}
+
+	graph := gographviz.NewGraph()
+	name := m.Name
+	if name == "" {
+		name = "G"
+	}
+	if err := graph.SetName(name); err != nil {
+		return nil, err
+	}
+	if err := graph.SetDir(true); err != nil {
+		return nil, err
+	}
+	for key, value := range m.Style {
+		if err := graph.AddAttr(graph.Name, key, address.Quote(value)); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(m.Icons) > 0 {
+		for image, uri := range m.Icons {
+			data, err := decodeDataURI(uri)
+			if err != nil {
+				return nil, fmt.Errorf("invalid icon %s: %v", image, err)
+			}
+			if err := os.WriteFile(filepath.Join(imageDir, filepath.Base(image)), data, 0644); err != nil {
+				return nil, err
+			}
+		}
+		graph.Attrs["imagepath"] = address.Quote(imageDir)
+	}
+
+	if err := m.addGroups(graph); err != nil {
+		return nil, err
+	}
+
+	for _, resource := range m.Resources {
+		attrs := quoted(resource.Style)
+		attrs["label"] = dotLabel(resource.Label)
+		if resource.Icon != "" {
+			attrs["image"] = address.Quote(filepath.Base(resource.Icon))
+		}
+		if err := addNode(graph, resource.Group, resource.ID, attrs); err != nil {
+			return nil, fmt.Errorf("invalid resource %s: %v", resource.ID, err)
+		}
+	}
+	for _, node := range m.Nodes {
+		attrs := quoted(node.Style)
+		attrs["label"] = dotLabel(node.Label)
+		if err := addNode(graph, node.Group, node.ID, attrs); err != nil {
+			return nil, fmt.Errorf("invalid node %s: %v", node.ID, err)
+		}
+	}
+
+	for _, edge := range m.Edges {
+		if !graph.IsNode(address.Quote(edge.From)) || !graph.IsNode(address.Quote(edge.To)) {
+			return nil, fmt.Errorf("edge %s -> %s connects an unknown node", edge.From, edge.To)
+		}
+		attrs := quoted(edge.Style)
+		if edge.Label != "" {
+			attrs["label"] = dotLabel(edge.Label)
+		}
+		if edge.Type != "" && edge.Type != EdgeDependency {
+			attrs[typeAttribute] = address.Quote(edge.Type)
+		}
+		if err := graph.AddEdge(address.Quote(edge.From), address.Quote(edge.To), true, attrs); err != nil {
+			return nil, fmt.Errorf("invalid edge %s -> %s: %v", edge.From, edge.To, err)
+		}
+	}
+
+	return graph, nil
+}
+
+// addGroups adds the groups as subgraphs, parents before their children.
+func (m *Model) addGroups(graph *gographviz.Graph) error {
+	groups := make(map[string]Group)
+	for _, group := range m.Groups {
+		groups[group.ID] = group
+	}
+
+	added := make(map[string]bool)
+	var add func(group Group, path []string) error
+	add = func(group Group, path []string) error {
+		if added[group.ID] {
+			return nil
+		}
+		if address.Contains(path, group.ID) {
+			return fmt.Errorf("group %s is its own ancestor", group.ID)
+		}
+		parent := graph.Name
+		if group.Parent != "" {
+			parentGroup, ok := groups[group.Parent]
+			if !ok {
+				return fmt.Errorf("group %s has an unknown parent %s", group.ID, group.Parent)
+			}
+			if err := add(parentGroup, append(path, group.ID)); err != nil {
+				return err
+			}
+			parent = address.Quote(group.Parent)
+		}
+
+		attrs := quoted(group.Style)
+		if group.Label != "" {
+			attrs["label"] = dotLabel(group.Label)
+		}
+		if err := graph.AddSubGraph(parent, address.Quote(group.ID), attrs); err != nil {
+			return fmt.Errorf("invalid group %s: %v", group.ID, err)
+		}
+		added[group.ID] = true
+		return nil
+	}
+
+	for _, group := range m.Groups {
+		if err := add(group, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addNode adds a node to the graph, inside the group with the given id or the graph itself when it is empty.
+func addNode(graph *gographviz.Graph, group, id string, attrs map[string]string) error {
+	parent := graph.Name
+	if group != "" {
+		parent = address.Quote(group)
+		if !graph.IsSubGraph(parent) {
+			return fmt.Errorf("unknown group %s", group)
+		}
+	}
+	if graph.IsNode(address.Quote(id)) {
+		return fmt.Errorf("duplicate id")
+	}
+	return graph.AddNode(parent, address.Quote(id), attrs)
+}
+
+// Details returns what the model records about its resources, keyed by node name like the graph it converts to.
+func (m *Model) Details() map[string]Details {
+	details := make(map[string]Details)
+	for _, resource := range m.Resources {
+		details[address.Quote(resource.ID)] = Details{
+			Address:      resource.Address,
+			Provider:     resource.Provider,
+			Dependencies: resource.Dependencies,
+			Attributes:   resource.Attributes,
+		}
+	}
+	return details
+}
+
+// Write writes the model as indented JSON.
+func (m *Model) Write(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(m)
+}
+
+// Read reads a model written by Write, or by hand.
+func Read(r io.Reader) (*Model, error) {
+	var m Model
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&m); err != nil {
+		return nil, fmt.Errorf("invalid model: %v", err)
+	}
+	return &m, nil
+}
+
+// parent returns the group something is drawn in, empty for the graph itself. Something listed in several
+// subgraphs belongs to the first one by name.
+func parent(graph *gographviz.Graph, name string) string {
+	var parents []string
+	for p := range graph.Relations.ChildToParents[name] {
+		if p != graph.Name && p != name {
+			parents = append(parents, p)
+		}
+	}
+	if len(parents) == 0 {
+		return ""
+	}
+	sort.Strings(parents)
+	return address.Unquote(parents[0])
+}
+
+// style returns the DOT attributes not covered by the fields of the model, without quotes.
+func style(attrs gographviz.Attrs) map[string]string {
+	result := make(map[string]string)
+	for key, value := range attrs {
+		if !ownAttributes[string(key)] {
+			result[string(key)] = address.Unquote(value)
+		}
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
+
+// quoted returns attributes from the model as quoted DOT values.
+func quoted(attrs map[string]string) map[string]string {
+	result := make(map[string]string, len(attrs)+1)
+	for key, value := range attrs {
+		result[key] = address.Quote(value)
+	}
+	return result
+}
+
+// nodeLabel returns the label of a node as text, a node without label shows its name.
+func nodeLabel(node *gographviz.Node) string {
+	if value, ok := node.Attrs["label"]; ok {
+		return label(value)
+	}
+	return address.Unquote(node.Name)
+}
+
+// label turns a DOT label into text, line breaks become newlines.
+func label(value string) string {
+	return strings.ReplaceAll(address.Unquote(value), `\n`, "\n")
+}
+
+// dotLabel is the inverse of label.
+func dotLabel(text string) string {
+	return address.Quote(strings.ReplaceAll(text, "\n", `\n`))
+}
+
+// decodeDataURI returns the content of a base64 encoded data URI.
+func decodeDataURI(uri string) ([]byte, error) {
+	_, encoded, found := strings.Cut(uri, ";base64,")
+	if !strings.HasPrefix(uri, "data:") || !found {
+		return nil, fmt.Errorf("not a base64 data URI")
+	}
+	return base64.StdEncoding.DecodeString(encoded)
+}
@@ -0,0 +1,158 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/awalterschulze/gographviz"
+)
+
+const graphWithGroups = `digraph G {
+	rankdir="BT";
+	subgraph "cluster_module.net[0]" {
+		label="module.net[0]";
+		subgraph "cluster_module.net[0].azurerm_virtual_network.vnet" {
+			label="vnet\naddress_space: 10.0.0.0/16";
+			margin="20";
+			"module.net[0].azurerm_subnet.this[\"web\"]" [ label="web", image="azurerm_subnet.png", shape="none" ];
+		}
+		"module.net[0].azurerm_virtual_network.vnet" [ label="" ];
+	}
+	"var.location" [ label="location" ];
+	"module.net[0].azurerm_subnet.this[\"web\"]" -> "module.net[0].azurerm_virtual_network.vnet" [ style=invis ];
+	"module.net[0].azurerm_subnet.this[\"web\"]" -> "var.location" [ comment="reference", label="location" ];
+}`
+
+func TestFromGraph(t *testing.T) {
+	graph := readGraph(t)
+	details := map[string]Details{
+		`"module.net[0].azurerm_subnet.this[\"web\"]"`: {Attributes: map[string]interface{}{"name": "web"}},
+	}
+
+	m, err := FromGraph(graph, details)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m.Resources) != 2 || len(m.Nodes) != 1 || len(m.Groups) != 2 || len(m.Edges) != 2 {
+		t.Fatalf("got %d resources, %d nodes, %d groups and %d edges", len(m.Resources), len(m.Nodes), len(m.Groups), len(m.Edges))
+	}
+	subnet := m.Resources[0]
+	if subnet.Type != "azurerm_subnet" || subnet.Name != "this" || subnet.ModulePath != "module.net[0]" || subnet.Index != "web" {
+		t.Errorf("unexpected subnet %+v", subnet)
+	}
+	if subnet.Group != "cluster_module.net[0].azurerm_virtual_network.vnet" || subnet.Attributes["name"] != "web" {
+		t.Errorf("unexpected subnet group or attributes %+v", subnet)
+	}
+	if m.Icons["azurerm_subnet.png"] == "" {
+		t.Error("icon was not embedded")
+	}
+	vnet := m.Groups[1]
+	if vnet.Kind != GroupResource || vnet.Parent != "cluster_module.net[0]" || vnet.Label != "vnet\naddress_space: 10.0.0.0/16" {
+		t.Errorf("unexpected group %+v", vnet)
+	}
+	if m.Groups[0].Kind != GroupModule {
+		t.Errorf("unexpected group %+v", m.Groups[0])
+	}
+	if edge := m.Edges[1]; edge.Type != "reference" || edge.Label != "location" {
+		t.Errorf("unexpected edge %+v", edge)
+	}
+}
+
+func TestModelRoundTrip(t *testing.T) {
+	m, err := FromGraph(readGraph(t), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var output bytes.Buffer
+	if err := m.Write(&output); err != nil {
+		t.Fatal(err)
+	}
+	read, err := Read(&output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	graph, err := read.Graph(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := FromGraph(graph, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(m, again) {
+		t.Errorf("model changed converting it to a graph and back\nbefore: %+v\nafter:  %+v", m, again)
+	}
+}
+
+func TestGraphRejectsUnknownGroups(t *testing.T) {
+	m := &Model{
+		Version:   Version,
+		Resources: []Resource{{ID: "azurerm_subnet.web", Group: "cluster_missing"}},
+	}
+	if _, err := m.Graph(t.TempDir()); err == nil {
+		t.Error("expected an error for a resource in an unknown group")
+	}
+}
+
+// TestSchemaMatchesModel keeps schema.json in line with the fields of the model.
+func TestSchemaMatchesModel(t *testing.T) {
+	data, err := os.ReadFile("schema.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	type object struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	var schema struct {
+		object
+		Defs map[string]object `json:"$defs"`
+	}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatalf("invalid schema: %v", err)
+	}
+
+	objects := map[string]object{"model": schema.object}
+	for name, def := range schema.Defs {
+		objects[name] = def
+	}
+	types := map[string]interface{}{"model": Model{}, "resource": Resource{}, "node": Node{}, "group": Group{}, "edge": Edge{}}
+	for name, value := range types {
+		var fields, properties []string
+		structType := reflect.TypeOf(value)
+		for i := 0; i < structType.NumField(); i++ {
+			fields = append(fields, strings.Split(structType.Field(i).Tag.Get("json"), ",")[0])
+		}
+		for property := range objects[name].Properties {
+			properties = append(properties, property)
+		}
+		sort.Strings(fields)
+		sort.Strings(properties)
+		if !reflect.DeepEqual(fields, properties) {
+			t.Errorf("schema of %s has properties %v, the model has %v", name, properties, fields)
+		}
+	}
+}
+
+// readGraph reads graphWithGroups, with its icon in a temporary image path.
+func readGraph(t *testing.T) *gographviz.Graph {
+	t.Helper()
+	graph, err := gographviz.Read([]byte(graphWithGroups))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "azurerm_subnet.png"), []byte("\x89PNG\r\n\x1a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	graph.Attrs["imagepath"] = `"` + dir + `"`
+	return graph
+}
@@ -0,0 +1,83 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"os"
+
+	"github.com/awalterschulze/gographviz"
+	"github.com/goccy/go-graphviz"
+)
+
+// BuiltinRenderer runs Graphviz compiled to WebAssembly in process, so no Graphviz installation is needed.
+// Graphviz lays the graph out and writes SVG and JSON, PNG, JPG and PDF are drawn from that SVG.
+type BuiltinRenderer struct{}
+
+// Render lays out the graph with the dot layout and writes it in the given format.
+func (r *BuiltinRenderer) Render(ctx context.Context, graph *gographviz.Graph, format string, w io.Writer) error {
+	switch format {
+	case "svg", "json":
+		output, err := runGraphviz(ctx, graph, graphviz.Format(format))
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(output)
+		return err
+	case "png", "jpg", "pdf":
+	default:
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+
+	svg, err := runGraphviz(ctx, graph, graphviz.SVG)
+	if err != nil {
+		return err
+	}
+
+	img, err := rasterize(inlineImages(svg, imageDir(graph)), DPI)
+	if err != nil {
+		return err
+	}
+	switch format {
+	case "png":
+		return png.Encode(w, img)
+	case "jpg":
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: 90})
+	default:
+		return writePDF(w, img, DPI)
+	}
+}
+
+// runGraphviz lays the graph out and writes it in one of the formats of Graphviz itself.
+func runGraphviz(ctx context.Context, graph *gographviz.Graph, format graphviz.Format) ([]byte, error) {
+	gv, err := graphviz.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer gv.Close()
+
+	// The WebAssembly module only sees the file system given to it, serve the images from their directory
+	// and look them up at its root
+	dir := imageDir(graph)
+	if dir != "" {
+		graphviz.SetFileSystem(os.DirFS(dir))
+	}
+
+	parsed, err := graphviz.ParseBytes([]byte(graph.String()))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing DOT: %v", err)
+	}
+	defer parsed.Close()
+	if dir != "" {
+		parsed.SetImagePath("/")
+	}
+
+	var output bytes.Buffer
+	if err := gv.Render(ctx, parsed, format, &output); err != nil {
+		return nil, err
+	}
+	return output.Bytes(), nil
+}
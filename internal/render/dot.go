@@ -0,0 +1,29 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+
+	"github.com/awalterschulze/gographviz"
+)
+
+// DotRenderer runs the Graphviz dot binary, which has to be installed and on the PATH.
+type DotRenderer struct{}
+
+// Render pipes the graph into dot and copies its output to w.
+func (r *DotRenderer) Render(ctx context.Context, graph *gographviz.Graph, format string, w io.Writer) error {
+	cmd := exec.CommandContext(ctx, "dot", fmt.Sprintf("-T%s", format), fmt.Sprintf("-Gdpi=%d", DPI))
+	cmd.Stdin = bytes.NewBufferString(graph.String()) // Pass the DOT content as standard input
+	cmd.Stdout = w
+
+	// Capture standard error for the error message
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%v, output: %s", err, stderr.String())
+	}
+	return nil
+}
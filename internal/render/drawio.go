@@ -0,0 +1,248 @@
+package render
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"image"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/CiucurDaniel/terraview/internal/address"
+	"github.com/CiucurDaniel/terraview/internal/icons"
+	"github.com/awalterschulze/gographviz"
+)
+
+type mxFile struct {
+	XMLName xml.Name  `xml:"mxfile"`
+	Host    string    `xml:"host,attr"`
+	Diagram mxDiagram `xml:"diagram"`
+}
+
+type mxDiagram struct {
+	ID    string       `xml:"id,attr"`
+	Name  string       `xml:"name,attr"`
+	Model mxGraphModel `xml:"mxGraphModel"`
+}
+
+type mxGraphModel struct {
+	Grid   int      `xml:"grid,attr"`
+	Page   int      `xml:"page,attr"`
+	Arrows int      `xml:"arrows,attr"`
+	Cells  []mxCell `xml:"root>mxCell"`
+}
+
+type mxCell struct {
+	ID       string      `xml:"id,attr"`
+	Value    string      `xml:"value,attr,omitempty"`
+	Style    string      `xml:"style,attr,omitempty"`
+	Vertex   string      `xml:"vertex,attr,omitempty"`
+	Edge     string      `xml:"edge,attr,omitempty"`
+	Parent   string      `xml:"parent,attr,omitempty"`
+	Source   string      `xml:"source,attr,omitempty"`
+	Target   string      `xml:"target,attr,omitempty"`
+	Geometry *mxGeometry `xml:"mxGeometry,omitempty"`
+}
+
+type mxGeometry struct {
+	X        float64 `xml:"x,attr"`
+	Y        float64 `xml:"y,attr"`
+	Width    float64 `xml:"width,attr,omitempty"`
+	Height   float64 `xml:"height,attr,omitempty"`
+	Relative string  `xml:"relative,attr,omitempty"`
+	As       string  `xml:"as,attr"`
+}
+
+// WriteDrawio writes the graph as draw.io (diagrams.net) file, placing everything where the Graphviz layout,
+// given as the JSON Graphviz writes, put it. Clusters become containers holding their children, resources use
+// the stencil of their cloud or else their icon, so the file opens looking like the rendered image.
+func WriteDrawio(graph *gographviz.Graph, layoutJSON []byte, w io.Writer) error {
+	boxes, _, err := readLayout(layoutJSON)
+	if err != nil {
+		return err
+	}
+
+	cells := []mxCell{{ID: "0"}, {ID: "1", Parent: "0"}}
+	ids := map[string]string{graph.Name: "1"}
+	origins := map[string]box{graph.Name: {}}
+	dir := imageDir(graph)
+	fontsize := func(attrs gographviz.Attrs, fallback string) string {
+		if size := address.Unquote(attrs["fontsize"]); size != "" {
+			return size
+		}
+		return fallback
+	}
+
+	tree := children(graph)
+	var add func(parent string)
+	add = func(parent string) {
+		for _, name := range tree[parent] {
+			b, ok := boxes[address.Unquote(name)]
+			if !ok {
+				continue
+			}
+			id := fmt.Sprintf("n%d", len(ids))
+			ids[name] = id
+
+			// Geometry of children is relative to their container
+			origin := origins[parent]
+			geometry := &mxGeometry{X: round(b.X - origin.X), Y: round(b.Y - origin.Y), Width: round(b.W), Height: round(b.H), As: "geometry"}
+			cell := mxCell{ID: id, Vertex: "1", Parent: ids[parent], Geometry: geometry}
+
+			if subgraph, ok := graph.SubGraphs.SubGraphs[name]; ok {
+				cell.Value = drawioText(labelText(subgraph.Attrs["label"]))
+				cell.Style = "container=1;collapsible=0;html=1;whiteSpace=wrap;rounded=0;fillColor=none;align=center;" +
+					"verticalAlign=" + verticalAlign(subgraph.Attrs["labelloc"]) + ";fontSize=" + fontsize(subgraph.Attrs, "14") + ";"
+				cells = append(cells, cell)
+				origins[name] = b
+				add(name)
+				continue
+			}
+
+			node := graph.Nodes.Lookup[name]
+			cell.Value = drawioText(labelText(node.Attrs["label"]))
+			stencil, icon := nodeStencil(node, dir)
+			cell.Style = stencil + "html=1;whiteSpace=wrap;fontSize=" + fontsize(node.Attrs, "14") + ";" + drawioColors(node.Attrs)
+			if icon {
+				// Icons keep their size, the label goes below them inside the box the layout reserved
+				size := iconSize(node, dir, b)
+				label := float64(strings.Count(labelText(node.Attrs["label"]), "\n")+1) * 1.3 * parseSize(fontsize(node.Attrs, "14"))
+				geometry.X = round(b.X - origin.X + (b.W-size)/2)
+				geometry.Y = round(b.Y - origin.Y + (b.H-size-label)/2)
+				geometry.Width, geometry.Height = round(size), round(size)
+				cell.Style += "verticalLabelPosition=bottom;verticalAlign=top;labelPosition=center;align=center;"
+			}
+			cells = append(cells, cell)
+		}
+	}
+	add(graph.Name)
+
+	for i, edge := range visibleEdges(graph) {
+		src, srcOK := ids[edge.Src]
+		dst, dstOK := ids[edge.Dst]
+		if !srcOK || !dstOK {
+			continue
+		}
+		cells = append(cells, mxCell{
+			ID:       fmt.Sprintf("e%d", i),
+			Style:    "edgeStyle=none;html=1;endArrow=classic;" + drawioColors(edge.Attrs),
+			Edge:     "1",
+			Parent:   "1",
+			Source:   src,
+			Target:   dst,
+			Geometry: &mxGeometry{Relative: "1", As: "geometry"},
+		})
+	}
+
+	file := mxFile{
+		Host:    "terraview",
+		Diagram: mxDiagram{ID: "terraview", Name: "terraview", Model: mxGraphModel{Grid: 1, Arrows: 1, Cells: cells}},
+	}
+	output, err := xml.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(output, '\n'))
+	return err
+}
+
+// nodeStencil returns the start of the style of a node: the stencil of its resource type, else its icon
+// embedded as data URI, else a plain box. It reports whether the node is drawn as icon.
+func nodeStencil(node *gographviz.Node, dir string) (string, bool) {
+	if addr, err := address.Parse(node.Name); err == nil && !addr.IsModuleCall() {
+		if style, ok := icons.Stencil(addr.Type); ok {
+			return style, true
+		}
+	}
+	if data, ok := nodeImage(node, dir); ok {
+		// draw.io separates style entries with semicolons, so the data URI leaves out ;base64
+		return "shape=image;aspect=fixed;image=data:image/png," + base64.StdEncoding.EncodeToString(data) + ";", true
+	}
+	return "rounded=1;", false
+}
+
+// nodeImage reads the image file of a node.
+func nodeImage(node *gographviz.Node, dir string) ([]byte, bool) {
+	name := address.Unquote(node.Attrs["image"])
+	if name == "" {
+		return nil, false
+	}
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(dir, name)
+	}
+	data, err := os.ReadFile(name)
+	return data, err == nil
+}
+
+// iconSize returns the size of the icon of a node in points, the way Graphviz sizes images, at most the size of its box.
+func iconSize(node *gographviz.Node, dir string, b box) float64 {
+	size := 48.0
+	if data, ok := nodeImage(node, dir); ok {
+		if config, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+			size = float64(config.Width) * 72 / 96
+		}
+	}
+	if size > b.W {
+		size = b.W
+	}
+	if size > b.H {
+		size = b.H
+	}
+	return size
+}
+
+// drawioText escapes a label for an HTML value, lines are joined with <br>.
+func drawioText(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = html.EscapeString(line)
+	}
+	return strings.Join(lines, "<br>")
+}
+
+// drawioColors returns the draw.io style of the colors set on a node or edge, e.g. by the planned action.
+func drawioColors(attrs gographviz.Attrs) string {
+	var style string
+	if fill := address.Unquote(attrs["fillcolor"]); fill != "" {
+		style += "fillColor=" + fill + ";imageBackground=" + fill + ";"
+	}
+	if stroke := address.Unquote(attrs["color"]); stroke != "" {
+		style += "strokeColor=" + stroke + ";imageBorder=" + stroke + ";"
+	}
+	if font := address.Unquote(attrs["fontcolor"]); font != "" {
+		style += "fontColor=" + font + ";"
+	}
+	if strings.Contains(address.Unquote(attrs["style"]), "dashed") {
+		style += "dashed=1;"
+	}
+	return style
+}
+
+// verticalAlign returns the draw.io alignment of a Graphviz labelloc.
+func verticalAlign(labelloc string) string {
+	switch address.Unquote(labelloc) {
+	case "b":
+		return "bottom"
+	case "c":
+		return "middle"
+	default:
+		return "top"
+	}
+}
+
+func parseSize(s string) float64 {
+	values := parseFloats(s)
+	if len(values) == 0 {
+		return 14
+	}
+	return values[0]
+}
+
+func round(value float64) float64 {
+	return math.Round(value*100) / 100
+}
@@ -0,0 +1,85 @@
+package render
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/awalterschulze/gographviz"
+)
+
+// layoutJSON is what Graphviz writes for the graph in TestWriteDrawio, cut down to the attributes used.
+const layoutJSON = `{
+	"bb": "0,0,300,200",
+	"objects": [
+		{"name": "cluster_azurerm_virtual_network.vnet", "bb": "10,10,210,190"},
+		{"name": "azurerm_virtual_network.vnet", "pos": "110,140", "width": "1", "height": "1"},
+		{"name": "kubernetes_namespace.app", "pos": "110,50", "width": "1", "height": "0.5"},
+		{"name": "var.location", "pos": "260,100", "width": "0.5", "height": "0.5"}
+	]
+}`
+
+func TestWriteDrawio(t *testing.T) {
+	graph, err := gographviz.Read([]byte(`digraph G {
+	subgraph "cluster_azurerm_virtual_network.vnet" {
+		label="vnet";
+		"azurerm_virtual_network.vnet" [ label="" ];
+		"kubernetes_namespace.app" [ label="vm\nsize: B1s", shape="box" ];
+	}
+	"var.location" [ label="location" ];
+	"kubernetes_namespace.app" -> "azurerm_virtual_network.vnet";
+	"azurerm_virtual_network.vnet" -> "var.location" [ style=invis ];
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var output bytes.Buffer
+	if err := WriteDrawio(graph, []byte(layoutJSON), &output); err != nil {
+		t.Fatal(err)
+	}
+
+	var file mxFile
+	if err := xml.Unmarshal(output.Bytes(), &file); err != nil {
+		t.Fatalf("invalid XML: %v\n%s", err, output.String())
+	}
+	cells := make(map[string]mxCell)
+	for _, cell := range file.Diagram.Model.Cells {
+		cells[cell.Value] = cell
+	}
+
+	container := cells["vnet"]
+	if container.Parent != "1" || container.Geometry.X != 10 || container.Geometry.Y != 10 {
+		t.Errorf("container = %+v %+v, want at 10,10 on the root", container, container.Geometry)
+	}
+
+	// The box is placed relative to its container, which starts at 10,10 with y counted downwards
+	vm := cells["vm<br>size: B1s"]
+	if vm.Parent != container.ID {
+		t.Errorf("vm parent = %s, want %s", vm.Parent, container.ID)
+	}
+	if vm.Geometry.X != 64 || vm.Geometry.Y != 122 || vm.Geometry.Width != 72 || vm.Geometry.Height != 36 {
+		t.Errorf("vm geometry = %+v", vm.Geometry)
+	}
+
+	// Resources with a stencil of their cloud use it
+	for _, cell := range file.Diagram.Model.Cells {
+		if cell.Parent == container.ID && cell.Value == "" && !strings.Contains(cell.Style, "azure2/networking/Virtual_Networks.svg") {
+			t.Errorf("vnet style = %s, want the Azure stencil", cell.Style)
+		}
+	}
+
+	var edges int
+	for _, cell := range file.Diagram.Model.Cells {
+		if cell.Edge == "1" {
+			edges++
+			if cell.Source != vm.ID {
+				t.Errorf("edge source = %s, want %s", cell.Source, vm.ID)
+			}
+		}
+	}
+	if edges != 1 {
+		t.Errorf("%d edges, want 1 as the hidden one is left out", edges)
+	}
+}
@@ -0,0 +1,151 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+
+	"github.com/CiucurDaniel/terraview/internal/address"
+	"github.com/CiucurDaniel/terraview/internal/model"
+	"github.com/awalterschulze/gographviz"
+)
+
+//go:embed page.html
+var pageTemplate string
+
+var page = template.Must(template.New("page").Parse(pageTemplate))
+
+// pageData is the part of the drawing the script of the page works with. Nodes, clusters and edges are keyed
+// by the id of their element in the SVG.
+type pageData struct {
+	Nodes    map[string]pageNode    `json:"nodes"`
+	Clusters map[string]pageCluster `json:"clusters"`
+	Edges    []pageEdge             `json:"edges"`
+}
+
+type pageNode struct {
+	Name    string         `json:"name"`
+	Details *model.Details `json:"details,omitempty"`
+}
+
+// pageCluster lists the nodes and clusters directly inside a cluster, and the grouping node it stands for.
+type pageCluster struct {
+	Label   string   `json:"label"`
+	Node    string   `json:"node,omitempty"`
+	Members []string `json:"members"`
+}
+
+type pageEdge struct {
+	ID  string `json:"id"`
+	Src string `json:"src"`
+	Dst string `json:"dst"`
+}
+
+// WriteHTML writes a single HTML page showing the graph as SVG with its images inlined. The page can be panned and
+// zoomed, selecting a node shows its details and highlights its neighbors, clusters can be collapsed.
+// details are keyed by node name, nodes without details only show their name.
+func WriteHTML(ctx context.Context, graph *gographviz.Graph, details map[string]model.Details, renderer Renderer, w io.Writer) error {
+	// Work on a copy, the ids given to the elements are only needed to find them in this SVG
+	copied, err := gographviz.Read([]byte(graph.String()))
+	if err != nil {
+		return fmt.Errorf("error copying graph: %v", err)
+	}
+	data := identifyElements(copied, details)
+
+	var svg bytes.Buffer
+	if err := renderer.Render(ctx, copied, "svg", &svg); err != nil {
+		return fmt.Errorf("error converting DOT to svg: %v", err)
+	}
+	drawing := inlineImages(svg.Bytes(), imageDir(graph))
+	// The page holds the svg element only, without the XML declaration and doctype
+	if start := bytes.Index(drawing, []byte("<svg")); start >= 0 {
+		drawing = drawing[start:]
+	}
+
+	return page.Execute(w, struct {
+		Title string
+		SVG   template.HTML
+		Data  pageData
+	}{
+		Title: "terraview",
+		SVG:   template.HTML(drawing),
+		Data:  data,
+	})
+}
+
+// identifyElements gives every node, cluster and edge of the graph an id which Graphviz writes into the SVG, and
+// returns what the page needs to know about them.
+func identifyElements(graph *gographviz.Graph, details map[string]model.Details) pageData {
+	data := pageData{
+		Nodes:    make(map[string]pageNode),
+		Clusters: make(map[string]pageCluster),
+		Edges:    []pageEdge{},
+	}
+
+	ids := make(map[string]string)
+	for i, node := range graph.Nodes.Sorted() {
+		id := fmt.Sprintf("n%d", i)
+		ids[node.Name] = id
+		node.Attrs["id"] = address.Quote(id)
+		pageNode := pageNode{Name: address.Unquote(node.Name)}
+		if resourceDetails, ok := details[node.Name]; ok {
+			pageNode.Details = &resourceDetails
+		}
+		data.Nodes[id] = pageNode
+	}
+
+	names := address.SortedKeys(graph.SubGraphs.SubGraphs)
+	for i, name := range names {
+		ids[name] = fmt.Sprintf("c%d", i)
+		graph.SubGraphs.SubGraphs[name].Attrs["id"] = address.Quote(ids[name])
+	}
+	// Only clusters are drawn, other subgraphs just pass their members on to the enclosing cluster
+	tree := children(graph)
+	var members func(name string) []string
+	members = func(name string) []string {
+		result := []string{}
+		for _, child := range tree[name] {
+			if graph.IsSubGraph(child) && !isCluster(child) {
+				result = append(result, members(child)...)
+				continue
+			}
+			result = append(result, ids[child])
+		}
+		return result
+	}
+	for _, name := range names {
+		if !isCluster(name) {
+			continue
+		}
+		cluster := pageCluster{
+			Label:   labelText(graph.SubGraphs.SubGraphs[name].Attrs["label"]),
+			Members: members(name),
+		}
+		for _, node := range graph.Nodes.Nodes {
+			if grouping, ok := groupingCluster(graph, node); ok && grouping == name {
+				cluster.Node = ids[node.Name]
+			}
+		}
+		data.Clusters[ids[name]] = cluster
+	}
+
+	for i, edge := range graph.Edges.Sorted() {
+		id := fmt.Sprintf("e%d", i)
+		edge.Attrs["id"] = address.Quote(id)
+		if address.Unquote(edge.Attrs["style"]) == "invis" {
+			continue
+		}
+		data.Edges = append(data.Edges, pageEdge{ID: id, Src: ids[edge.Src], Dst: ids[edge.Dst]})
+	}
+
+	return data
+}
+
+// isCluster checks if a subgraph is drawn as a box, which Graphviz does for names starting with cluster.
+func isCluster(name string) bool {
+	return strings.HasPrefix(address.Unquote(name), "cluster")
+}
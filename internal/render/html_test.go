@@ -0,0 +1,44 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/CiucurDaniel/terraview/internal/model"
+	"github.com/awalterschulze/gographviz"
+)
+
+func TestWriteHTML(t *testing.T) {
+	graph, err := gographviz.Read([]byte(clusterGraph))
+	if err != nil {
+		t.Fatal(err)
+	}
+	details := map[string]model.Details{
+		`"azurerm_subnet.web"`: {
+			Address:    "azurerm_subnet.web",
+			Provider:   `provider["registry.terraform.io/hashicorp/azurerm"]`,
+			Attributes: map[string]interface{}{"name": "web"},
+		},
+	}
+
+	var output bytes.Buffer
+	if err := WriteHTML(context.Background(), graph, details, &BuiltinRenderer{}, &output); err != nil {
+		t.Fatal(err)
+	}
+	page := output.String()
+
+	for _, want := range []string{`<svg`, `id="n0"`, `id="n1"`, `id="c0"`, `id="e0"`, `"address":"azurerm_subnet.web"`, `"members":["n1"]`} {
+		if !strings.Contains(page, want) {
+			t.Errorf("page does not contain %s", want)
+		}
+	}
+	if strings.Contains(page, "<?xml") {
+		t.Error("page contains the XML declaration of the SVG")
+	}
+	// The graph itself is left as it was
+	if _, ok := graph.Nodes.Lookup[`"azurerm_subnet.web"`].Attrs["id"]; ok {
+		t.Error("ids were set on the graph instead of a copy")
+	}
+}
@@ -0,0 +1,71 @@
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// box is a rectangle of a laid out graph in points, measured from the top left corner of the drawing.
+type box struct {
+	X, Y, W, H float64
+}
+
+// layoutObject is a subgraph or node in the JSON Graphviz writes. Subgraphs have a bounding box,
+// nodes a center position and a size in inches.
+type layoutObject struct {
+	Name   string `json:"name"`
+	BB     string `json:"bb"`
+	Pos    string `json:"pos"`
+	Width  string `json:"width"`
+	Height string `json:"height"`
+}
+
+// readLayout reads the boxes of the subgraphs and nodes from the JSON output of Graphviz, keyed by their
+// unquoted names, together with the size of the whole drawing. Graphviz counts y upwards, it is flipped.
+func readLayout(data []byte) (map[string]box, box, error) {
+	var layout struct {
+		BB      string         `json:"bb"`
+		Objects []layoutObject `json:"objects"`
+	}
+	if err := json.Unmarshal(data, &layout); err != nil {
+		return nil, box{}, fmt.Errorf("error reading layout: %v", err)
+	}
+
+	bounds := parseFloats(layout.BB)
+	if len(bounds) != 4 {
+		return nil, box{}, fmt.Errorf("error reading layout: invalid bounding box %q", layout.BB)
+	}
+	height := bounds[3]
+
+	boxes := make(map[string]box)
+	for _, object := range layout.Objects {
+		if bb := parseFloats(object.BB); len(bb) == 4 {
+			boxes[object.Name] = box{X: bb[0], Y: height - bb[3], W: bb[2] - bb[0], H: bb[3] - bb[1]}
+			continue
+		}
+		pos := parseFloats(object.Pos)
+		if len(pos) != 2 {
+			continue
+		}
+		w, _ := strconv.ParseFloat(object.Width, 64)
+		h, _ := strconv.ParseFloat(object.Height, 64)
+		w, h = w*72, h*72
+		boxes[object.Name] = box{X: pos[0] - w/2, Y: height - pos[1] - h/2, W: w, H: h}
+	}
+	return boxes, box{W: bounds[2] - bounds[0], H: height - bounds[1]}, nil
+}
+
+// parseFloats reads a comma separated list of numbers, like the bb and pos attributes of Graphviz.
+func parseFloats(s string) []float64 {
+	var values []float64
+	for _, field := range strings.Split(s, ",") {
+		value, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return nil
+		}
+		values = append(values, value)
+	}
+	return values
+}
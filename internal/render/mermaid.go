@@ -0,0 +1,129 @@
+package render
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/CiucurDaniel/terraview/internal/address"
+	"github.com/awalterschulze/gographviz"
+)
+
+// WriteMermaid writes the graph as Mermaid flowchart. Clusters become subgraphs, grouping resources are drawn as
+// the subgraph they open, labels keep their attribute lines and edges hidden in the graph are left out.
+func WriteMermaid(graph *gographviz.Graph, w io.Writer) error {
+	var b strings.Builder
+
+	direction := address.Unquote(graph.Attrs["rankdir"])
+	if direction == "" {
+		direction = "TB"
+	}
+	fmt.Fprintf(&b, "flowchart %s\n", direction)
+
+	// Mermaid ids can not hold the characters of addresses, number everything instead
+	ids := make(map[string]string)
+	id := func(name string) string {
+		if _, ok := ids[name]; !ok {
+			ids[name] = fmt.Sprintf("n%d", len(ids))
+		}
+		return ids[name]
+	}
+
+	tree := children(graph)
+	var styles []string
+	var write func(parent string, depth int)
+	write = func(parent string, depth int) {
+		indent := strings.Repeat("    ", depth)
+		for _, name := range tree[parent] {
+			if subgraph, ok := graph.SubGraphs.SubGraphs[name]; ok {
+				fmt.Fprintf(&b, "%ssubgraph %s[\"%s\"]\n", indent, id(name), mermaidText(labelText(subgraph.Attrs["label"])))
+				write(name, depth+1)
+				fmt.Fprintf(&b, "%send\n", indent)
+				continue
+			}
+
+			// A grouping resource is drawn as its subgraph, which takes over its colors
+			node := graph.Nodes.Lookup[name]
+			if cluster, ok := groupingCluster(graph, node); ok {
+				if style := mermaidStyle(node.Attrs); style != "" {
+					styles = append(styles, fmt.Sprintf("style %s %s", id(cluster), style))
+				}
+				continue
+			}
+			label := labelText(node.Attrs["label"])
+			if label == "" {
+				label = address.Unquote(name)
+			}
+			fmt.Fprintf(&b, "%s%s[\"%s\"]\n", indent, id(name), mermaidText(label))
+			if style := mermaidStyle(node.Attrs); style != "" {
+				styles = append(styles, fmt.Sprintf("style %s %s", id(name), style))
+			}
+		}
+	}
+	write(graph.Name, 1)
+
+	// Edges of grouping resources point at their subgraph, the ones into a subgraph enclosing their source
+	// already show as nesting
+	parents := make(map[string]string)
+	for parent, names := range tree {
+		for _, name := range names {
+			parents[name] = parent
+		}
+	}
+	encloses := func(cluster, name string) bool {
+		for parent, ok := parents[name]; ok; parent, ok = parents[parent] {
+			if parent == cluster {
+				return true
+			}
+		}
+		return false
+	}
+	endpoint := func(name string) string {
+		if node, ok := graph.Nodes.Lookup[name]; ok {
+			if cluster, ok := groupingCluster(graph, node); ok {
+				return id(cluster)
+			}
+		}
+		return id(name)
+	}
+	for _, edge := range visibleEdges(graph) {
+		if node, ok := graph.Nodes.Lookup[edge.Dst]; ok {
+			if cluster, ok := groupingCluster(graph, node); ok && encloses(cluster, edge.Src) {
+				continue
+			}
+		}
+		src, dst := endpoint(edge.Src), endpoint(edge.Dst)
+		fmt.Fprintf(&b, "    %s --> %s\n", src, dst)
+	}
+
+	for _, style := range styles {
+		fmt.Fprintf(&b, "    %s\n", style)
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// mermaidText escapes text for a quoted Mermaid label, lines are joined with <br/>.
+func mermaidText(text string) string {
+	text = strings.ReplaceAll(text, `"`, "#quot;")
+	return strings.ReplaceAll(text, "\n", "<br/>")
+}
+
+// mermaidStyle returns the Mermaid style of a node colored in the graph, e.g. by the planned action.
+func mermaidStyle(attrs gographviz.Attrs) string {
+	var parts []string
+	if fill := address.Unquote(attrs["fillcolor"]); fill != "" {
+		parts = append(parts, "fill:"+fill)
+	}
+	if stroke := address.Unquote(attrs["color"]); stroke != "" {
+		parts = append(parts, "stroke:"+stroke)
+	}
+	if font := address.Unquote(attrs["fontcolor"]); font != "" {
+		parts = append(parts, "color:"+font)
+	}
+	if strings.Contains(address.Unquote(attrs["style"]), "dashed") {
+		parts = append(parts, "stroke-dasharray:5 5")
+	}
+	return strings.Join(parts, ",")
+}
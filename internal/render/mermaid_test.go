@@ -0,0 +1,45 @@
+package render
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/awalterschulze/gographviz"
+)
+
+func TestWriteMermaid(t *testing.T) {
+	graph, err := gographviz.Read([]byte(`digraph G {
+	rankdir="BT";
+	subgraph "cluster_azurerm_subnet.web" {
+		label="web\naddress_prefixes: 10.0.1.0/24";
+		"azurerm_subnet.web" [ label="" ];
+		"azurerm_network_interface.nic[\"a\"]" [ label="nic[\"a\"]", fillcolor="#dafbe1", color="#1a7f37" ];
+	}
+	"azurerm_resource_group.rg" [ label="rg" ];
+	"azurerm_network_interface.nic[\"a\"]" -> "azurerm_subnet.web";
+	"azurerm_subnet.web" -> "azurerm_resource_group.rg" [ style=invis ];
+	"azurerm_linux_virtual_machine.vm" -> "azurerm_subnet.web";
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var output bytes.Buffer
+	if err := WriteMermaid(graph, &output); err != nil {
+		t.Fatal(err)
+	}
+
+	// The edge into the enclosing subgraph and the hidden one are left out
+	want := `flowchart BT
+    n0["azurerm_linux_virtual_machine.vm"]
+    n1["rg"]
+    subgraph n2["web<br/>address_prefixes: 10.0.1.0/24"]
+        n3["nic[#quot;a#quot;]"]
+    end
+    n0 --> n2
+    style n3 fill:#dafbe1,stroke:#1a7f37
+`
+	if output.String() != want {
+		t.Errorf("WriteMermaid wrote\n%s\nwant\n%s", output.String(), want)
+	}
+}
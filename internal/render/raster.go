@@ -0,0 +1,370 @@
+package render
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/fogleman/gg"
+	"golang.org/x/image/colornames"
+	"golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goitalic"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+)
+
+// rasterizer draws an SVG written by Graphviz. It knows the elements Graphviz uses: polygons, ellipses, paths of
+// cubic Bézier curves, polylines, text and images embedded as data URIs. Coordinates are in points and scaled to pixels.
+type rasterizer struct {
+	dc     *gg.Context
+	scale  float64 // pixels per point, including the scale of the graph group
+	tx, ty float64 // translation of the graph group in points
+	fonts  map[string]font.Face
+}
+
+// fontFiles holds the Go fonts by style, they stand in for every font family
+var fontFiles = map[string][]byte{
+	"normal": goregular.TTF,
+	"bold":   gobold.TTF,
+	"italic": goitalic.TTF,
+}
+
+// rasterize draws an SVG written by Graphviz at the given resolution on a white background.
+func rasterize(svg []byte, dpi int) (image.Image, error) {
+	r := &rasterizer{fonts: make(map[string]font.Face)}
+
+	decoder := xml.NewDecoder(bytes.NewReader(svg))
+	// Graphviz declares the SVG 1.1 DTD, its entities are not needed to read the drawing
+	decoder.Strict = false
+	decoder.Entity = xml.HTMLEntity
+
+	var text *xml.StartElement
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("error reading SVG: %v", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			attrs := attributes(t)
+			switch t.Name.Local {
+			case "svg":
+				if err := r.start(attrs, dpi); err != nil {
+					return nil, err
+				}
+			case "g":
+				if transform, ok := attrs["transform"]; ok {
+					r.transform(transform)
+				}
+			case "text":
+				element := t.Copy()
+				text = &element
+			default:
+				if r.dc != nil {
+					r.draw(t.Name.Local, attrs)
+				}
+			}
+		case xml.CharData:
+			if text != nil && r.dc != nil {
+				r.drawText(attributes(*text), string(t))
+			}
+		case xml.EndElement:
+			if t.Name.Local == "text" {
+				text = nil
+			}
+		}
+	}
+
+	if r.dc == nil {
+		return nil, fmt.Errorf("error reading SVG: no svg element")
+	}
+	return r.dc.Image(), nil
+}
+
+func attributes(element xml.StartElement) map[string]string {
+	attrs := make(map[string]string, len(element.Attr))
+	for _, attr := range element.Attr {
+		attrs[attr.Name.Local] = attr.Value
+	}
+	return attrs
+}
+
+// start creates the canvas from the size of the svg element, which Graphviz gives in points.
+func (r *rasterizer) start(attrs map[string]string, dpi int) error {
+	width, err := strconv.ParseFloat(strings.TrimSuffix(attrs["width"], "pt"), 64)
+	if err != nil {
+		return fmt.Errorf("error reading SVG width: %v", err)
+	}
+	height, err := strconv.ParseFloat(strings.TrimSuffix(attrs["height"], "pt"), 64)
+	if err != nil {
+		return fmt.Errorf("error reading SVG height: %v", err)
+	}
+
+	r.scale = float64(dpi) / 72
+	r.dc = gg.NewContext(int(width*r.scale+0.5), int(height*r.scale+0.5))
+	r.dc.SetColor(color.White)
+	r.dc.Clear()
+	return nil
+}
+
+// transform applies the scale and translate Graphviz sets on the graph group, rotation is not supported.
+func (r *rasterizer) transform(transform string) {
+	for _, part := range strings.Split(transform, ")") {
+		name, args, found := strings.Cut(strings.TrimSpace(part), "(")
+		if !found {
+			continue
+		}
+		values := numbers(args)
+		switch name {
+		case "scale":
+			if len(values) > 0 {
+				r.scale *= values[0]
+			}
+		case "translate":
+			if len(values) > 1 {
+				r.tx += values[0]
+				r.ty += values[1]
+			}
+		}
+	}
+}
+
+// point converts a point of the drawing to pixels.
+func (r *rasterizer) point(x, y float64) (float64, float64) {
+	return (x + r.tx) * r.scale, (y + r.ty) * r.scale
+}
+
+func (r *rasterizer) draw(element string, attrs map[string]string) {
+	switch element {
+	case "polygon", "polyline":
+		values := numbers(attrs["points"])
+		for i := 0; i+1 < len(values); i += 2 {
+			r.dc.LineTo(r.point(values[i], values[i+1]))
+		}
+		if element == "polygon" {
+			r.dc.ClosePath()
+		}
+	case "ellipse":
+		x, y := r.point(number(attrs["cx"]), number(attrs["cy"]))
+		r.dc.DrawEllipse(x, y, number(attrs["rx"])*r.scale, number(attrs["ry"])*r.scale)
+	case "path":
+		r.path(attrs["d"])
+	case "image":
+		r.drawImage(attrs)
+		return
+	default:
+		return
+	}
+	r.paint(attrs)
+}
+
+// path draws the move, line and cubic Bézier commands Graphviz writes, all with absolute coordinates.
+func (r *rasterizer) path(d string) {
+	command := byte('M')
+	var values []float64
+	flush := func() {
+		switch command {
+		case 'M':
+			for i := 0; i+1 < len(values); i += 2 {
+				r.dc.MoveTo(r.point(values[i], values[i+1]))
+			}
+		case 'L':
+			for i := 0; i+1 < len(values); i += 2 {
+				r.dc.LineTo(r.point(values[i], values[i+1]))
+			}
+		case 'C':
+			for i := 0; i+5 < len(values); i += 6 {
+				x1, y1 := r.point(values[i], values[i+1])
+				x2, y2 := r.point(values[i+2], values[i+3])
+				x3, y3 := r.point(values[i+4], values[i+5])
+				r.dc.CubicTo(x1, y1, x2, y2, x3, y3)
+			}
+		case 'Z', 'z':
+			r.dc.ClosePath()
+		}
+		values = nil
+	}
+
+	start := 0
+	for i := 0; i <= len(d); i++ {
+		if i < len(d) && !strings.ContainsRune("MLCZz", rune(d[i])) {
+			continue
+		}
+		values = append(values, numbers(d[start:i])...)
+		flush()
+		if i < len(d) {
+			command = d[i]
+		}
+		start = i + 1
+	}
+}
+
+// paint fills and strokes the current path with the colors of the element.
+func (r *rasterizer) paint(attrs map[string]string) {
+	if fill, ok := parseColor(attrs["fill"], attrs["fill-opacity"]); ok {
+		r.dc.SetColor(fill)
+		r.dc.FillPreserve()
+	}
+	if stroke, ok := parseColor(attrs["stroke"], attrs["stroke-opacity"]); ok {
+		width := 1.0
+		if w, ok := attrs["stroke-width"]; ok {
+			width = number(w)
+		}
+		r.dc.SetColor(stroke)
+		r.dc.SetLineWidth(width * r.scale)
+		var dashes []float64
+		for _, dash := range numbers(attrs["stroke-dasharray"]) {
+			dashes = append(dashes, dash*r.scale)
+		}
+		r.dc.SetDash(dashes...)
+		r.dc.StrokePreserve()
+	}
+	r.dc.ClearPath()
+}
+
+func (r *rasterizer) drawText(attrs map[string]string, text string) {
+	if strings.TrimSpace(text) == "" {
+		return
+	}
+	size := 14.0
+	if s, ok := attrs["font-size"]; ok {
+		size = number(s)
+	}
+	style := "normal"
+	if attrs["font-weight"] == "bold" {
+		style = "bold"
+	} else if attrs["font-style"] == "italic" {
+		style = "italic"
+	}
+	face, err := r.font(style, size*r.scale)
+	if err != nil {
+		return
+	}
+
+	fill, ok := parseColor(attrs["fill"], attrs["fill-opacity"])
+	if !ok {
+		if _, set := attrs["fill"]; set {
+			return
+		}
+		fill = color.Black
+	}
+
+	anchor := 0.0
+	switch attrs["text-anchor"] {
+	case "middle":
+		anchor = 0.5
+	case "end":
+		anchor = 1
+	}
+
+	x, y := r.point(number(attrs["x"]), number(attrs["y"]))
+	r.dc.SetFontFace(face)
+	r.dc.SetColor(fill)
+	r.dc.DrawStringAnchored(text, x, y, anchor, 0)
+}
+
+// font returns the font face of the given style and size in pixels.
+func (r *rasterizer) font(style string, size float64) (font.Face, error) {
+	key := fmt.Sprintf("%s-%.2f", style, size)
+	if face, ok := r.fonts[key]; ok {
+		return face, nil
+	}
+	parsed, err := opentype.Parse(fontFiles[style])
+	if err != nil {
+		return nil, err
+	}
+	face, err := opentype.NewFace(parsed, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, err
+	}
+	r.fonts[key] = face
+	return face, nil
+}
+
+// drawImage draws an image embedded as data URI, scaled to the box Graphviz reserved for it.
+func (r *rasterizer) drawImage(attrs map[string]string) {
+	href := attrs["href"]
+	_, encoded, found := strings.Cut(href, ";base64,")
+	if !strings.HasPrefix(href, "data:") || !found {
+		return
+	}
+	data, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return
+	}
+
+	// Graphviz writes the size in pixels at 96 DPI
+	width := number(strings.TrimSuffix(attrs["width"], "px")) * 72 / 96
+	height := number(strings.TrimSuffix(attrs["height"], "px")) * 72 / 96
+	x0, y0 := r.point(number(attrs["x"]), number(attrs["y"]))
+	x1, y1 := x0+width*r.scale, y0+height*r.scale
+
+	canvas, ok := r.dc.Image().(draw.Image)
+	if !ok {
+		return
+	}
+	box := image.Rect(int(x0+0.5), int(y0+0.5), int(x1+0.5), int(y1+0.5))
+	draw.CatmullRom.Scale(canvas, box, img, img.Bounds(), draw.Over, nil)
+}
+
+// parseColor reads an SVG color, which Graphviz writes as name or #rrggbb. none and transparent are not painted.
+func parseColor(value, opacity string) (color.Color, bool) {
+	var c color.RGBA
+	switch {
+	case value == "" || value == "none" || value == "transparent":
+		return nil, false
+	case strings.HasPrefix(value, "#") && len(value) == 7:
+		rgb, err := strconv.ParseUint(value[1:], 16, 32)
+		if err != nil {
+			return nil, false
+		}
+		c = color.RGBA{R: uint8(rgb >> 16), G: uint8(rgb >> 8), B: uint8(rgb), A: 0xff}
+	default:
+		named, ok := colornames.Map[strings.ToLower(value)]
+		if !ok {
+			return nil, false
+		}
+		c = named
+	}
+
+	if opacity != "" {
+		alpha := number(opacity)
+		return color.NRGBA{R: c.R, G: c.G, B: c.B, A: uint8(alpha * 0xff)}, alpha > 0
+	}
+	return c, true
+}
+
+// numbers reads the numbers of a list separated by spaces or commas.
+func numbers(s string) []float64 {
+	fields := strings.FieldsFunc(s, func(r rune) bool { return r == ' ' || r == ',' || r == '\n' || r == '\t' })
+	values := make([]float64, 0, len(fields))
+	for _, field := range fields {
+		if value, err := strconv.ParseFloat(field, 64); err == nil {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func number(s string) float64 {
+	value, _ := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	return value
+}
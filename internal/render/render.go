@@ -2,58 +2,233 @@ package render
 
 import (
 	"bytes"
+	"context"
 	"fmt"
-	"github.com/awalterschulze/gographviz"
+	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strings"
 	"time"
+
+	"github.com/CiucurDaniel/terraview/internal/address"
+	"github.com/CiucurDaniel/terraview/internal/model"
+	"github.com/awalterschulze/gographviz"
 )
 
 var DPI = 96
 
-// SaveGraphAs saves the given graph in the specified format.
-func SaveGraphAs(graph *gographviz.Graph, baseName string, format string) error {
-	// Render the graph to DOT format
-	dot := graph.String()
+// Renderer lays out a graph and writes it in an image format.
+type Renderer interface {
+	Render(ctx context.Context, graph *gographviz.Graph, format string, w io.Writer) error
+}
 
-	// Handle the special case where format is "DOT"
-	if format == "dot" {
-		fmt.Println(dot)
-		return nil
+// NewRenderer returns the rendering backend with the given name: builtin runs Graphviz in process and needs
+// nothing installed, dot runs the Graphviz dot binary found on the PATH.
+func NewRenderer(name string) (Renderer, error) {
+	switch name {
+	case "builtin":
+		return &BuiltinRenderer{}, nil
+	case "dot":
+		return &DotRenderer{}, nil
+	default:
+		return nil, fmt.Errorf("unknown renderer %s, expected builtin or dot", name)
 	}
+}
 
-	// Ensure the format is supported by Graphviz
-	supportedFormats := map[string]bool{
-		"png": true,
-		"jpg": true,
-		"svg": true,
-		"pdf": true,
-		"dot": true,
+// supportedFormats are the formats SaveGraphAs writes
+var supportedFormats = map[string]bool{
+	"png":     true,
+	"jpg":     true,
+	"svg":     true,
+	"pdf":     true,
+	"dot":     true,
+	"mermaid": true,
+	"drawio":  true,
+	"html":    true,
+	"json":    true,
+}
+
+// DefaultOutput is the output template used when none is given, a stable name in the current directory.
+const DefaultOutput = "diagram.{ext}"
+
+// SaveGraphAs saves the given graph in every format to the path the output template gives for it, see OutputPath.
+// An output of - writes the only format to stdout. All formats are checked before anything is written.
+// details describe the resources for the html and json formats and may be nil otherwise.
+func SaveGraphAs(graph *gographviz.Graph, output string, formats []string, renderer Renderer, details map[string]model.Details) error {
+	if err := CheckOutput(output, formats); err != nil {
+		return err
 	}
-	if !supportedFormats[format] {
-		return fmt.Errorf("unsupported format: %s", format)
+
+	now := time.Now()
+	for _, format := range formats {
+		if output == "-" {
+			var data bytes.Buffer
+			if err := writeFormat(graph, format, renderer, details, "", &data); err != nil {
+				return err
+			}
+			if _, err := os.Stdout.Write(data.Bytes()); err != nil {
+				return fmt.Errorf("error writing to stdout: %v", err)
+			}
+			continue
+		}
+
+		filePath := OutputPath(output, format, now)
+		// Ensure the output directory exists
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			return fmt.Errorf("error creating output directory: %v", err)
+		}
+		var data bytes.Buffer
+		if err := writeFormat(graph, format, renderer, details, filepath.Dir(filePath), &data); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filePath, data.Bytes(), 0644); err != nil {
+			return err
+		}
+		fmt.Fprintln(os.Stderr, "Wrote "+filePath)
 	}
+	return nil
+}
 
-	// Generate the filename with a timestamp
-	timestamp := time.Now().Format("20060102_150405")
-	filePath := fmt.Sprintf("%s_%s.%s", baseName, timestamp, format)
+// CheckOutput checks that the formats are supported and can all be written to the output.
+func CheckOutput(output string, formats []string) error {
+	if len(formats) == 0 {
+		return fmt.Errorf("no output format given")
+	}
+	for _, format := range formats {
+		if !supportedFormats[format] {
+			return fmt.Errorf("unsupported format: %s", format)
+		}
+	}
+	if len(formats) > 1 {
+		if output == "-" {
+			return fmt.Errorf("only one format can be written to stdout, got %s", strings.Join(formats, ", "))
+		}
+		if !strings.Contains(output, "{ext}") && !strings.Contains(output, "{format}") {
+			return fmt.Errorf("output %s must contain {ext} or {format} to write several formats", output)
+		}
+	}
+	return nil
+}
 
-	// Ensure the output directory exists
-	outputDir := filepath.Dir(filePath)
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		return fmt.Errorf("error creating output directory: %v", err)
+// OutputPath expands the placeholders of an output template: {ext} is the file extension of the format, {format} its
+// name and {timestamp} the time of the run, e.g. docs/diagram_{timestamp}.{ext} becomes docs/diagram_20240614_172636.png
+func OutputPath(template, format string, now time.Time) string {
+	return strings.NewReplacer(
+		"{ext}", extension(format),
+		"{format}", format,
+		"{timestamp}", now.Format("20060102_150405"),
+	).Replace(template)
+}
+
+// writeFormat writes the graph in one format, to a file in dir or to stdout when dir is empty.
+func writeFormat(graph *gographviz.Graph, format string, renderer Renderer, details map[string]model.Details, dir string, w io.Writer) error {
+	switch format {
+	case "dot":
+		if err := writeDOT(graph, dir, w); err != nil {
+			return fmt.Errorf("error writing DOT: %v", err)
+		}
+	case "mermaid":
+		if err := WriteMermaid(graph, w); err != nil {
+			return fmt.Errorf("error writing Mermaid: %v", err)
+		}
+	case "drawio":
+		// draw.io places everything where the Graphviz layout put it
+		var layout bytes.Buffer
+		if err := renderer.Render(context.Background(), graph, "json", &layout); err != nil {
+			return fmt.Errorf("error laying out graph: %v", err)
+		}
+		if err := WriteDrawio(graph, layout.Bytes(), w); err != nil {
+			return fmt.Errorf("error writing draw.io: %v", err)
+		}
+	case "html":
+		if err := WriteHTML(context.Background(), graph, details, renderer, w); err != nil {
+			return fmt.Errorf("error writing HTML: %v", err)
+		}
+	case "json":
+		m, err := model.FromGraph(graph, details)
+		if err != nil {
+			return fmt.Errorf("error building model: %v", err)
+		}
+		if err := m.Write(w); err != nil {
+			return fmt.Errorf("error writing model: %v", err)
+		}
+	case "svg":
+		// Images are only referenced by SVG, embed them so the file still shows them once they are gone
+		var svg bytes.Buffer
+		if err := renderer.Render(context.Background(), graph, format, &svg); err != nil {
+			return fmt.Errorf("error converting DOT to %s: %v", format, err)
+		}
+		_, err := w.Write(inlineImages(svg.Bytes(), imageDir(graph)))
+		return err
+	default:
+		if err := renderer.Render(context.Background(), graph, format, w); err != nil {
+			return fmt.Errorf("error converting DOT to %s: %v", format, err)
+		}
 	}
+	return nil
+}
 
-	// Convert DOT content to the specified format using Graphviz command-line tool
-	cmd := exec.Command("dot", fmt.Sprintf("-T%s", format), fmt.Sprintf("-Gdpi=%d", DPI), "-o", filePath)
-	cmd.Stdin = bytes.NewBufferString(dot) // Pass the DOT content as standard input
+// iconsDir is the directory next to a DOT file its images are copied to, its image path.
+const iconsDir = "icons"
 
-	// Capture standard output and standard error
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("error converting DOT to %s: %v, output: %s", format, err, string(output))
+// writeDOT writes the graph as DOT. The images of a run live in a temporary directory which is gone once it ends,
+// so they are copied to the icons directory in dir, which becomes the relative image path: the file stays the
+// same across runs and dot finds the images when run next to it. Written to stdout, the image path is left out.
+func writeDOT(graph *gographviz.Graph, dir string, w io.Writer) error {
+	source := imageDir(graph)
+	if imagepath, exists := graph.Attrs["imagepath"]; exists {
+		delete(graph.Attrs, "imagepath")
+		defer func() { graph.Attrs["imagepath"] = imagepath }()
 	}
 
-	return nil
+	if source != "" && dir != "" {
+		copied, err := copyImages(graph, source, filepath.Join(dir, iconsDir))
+		if err != nil {
+			return err
+		}
+		if copied > 0 {
+			graph.Attrs["imagepath"] = address.Quote(iconsDir)
+		}
+	}
+
+	_, err := io.WriteString(w, graph.String())
+	return err
+}
+
+// copyImages copies the images the nodes reference from source into target and returns how many it copied.
+// References which are URLs or absolute paths are left alone.
+func copyImages(graph *gographviz.Graph, source, target string) (int, error) {
+	copied := make(map[string]bool)
+	for _, node := range graph.Nodes.Nodes {
+		name := address.Unquote(node.Attrs["image"])
+		if name == "" || copied[name] || strings.Contains(name, "://") || filepath.IsAbs(name) {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(source, name))
+		if err != nil {
+			continue
+		}
+		if err := os.MkdirAll(target, 0755); err != nil {
+			return 0, fmt.Errorf("error creating icons directory: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(target, name), data, 0644); err != nil {
+			return 0, err
+		}
+		copied[name] = true
+	}
+	return len(copied), nil
+}
+
+// extension returns the file extension of a format.
+func extension(format string) string {
+	if format == "mermaid" {
+		return "mmd"
+	}
+	return format
+}
+
+// imageDir returns the directory the images of the graph are looked up in, empty if it has none.
+func imageDir(graph *gographviz.Graph) string {
+	return address.Unquote(graph.Attrs["imagepath"])
 }
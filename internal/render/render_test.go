@@ -0,0 +1,172 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/awalterschulze/gographviz"
+)
+
+const clusterGraph = `digraph G {
+	subgraph cluster_vnet {
+		label="vnet";
+		"azurerm_subnet.web" [ label="web" ];
+	}
+	"azurerm_network_interface.nic" -> "azurerm_subnet.web";
+}`
+
+func TestBuiltinRenderer(t *testing.T) {
+	graph, err := gographviz.Read([]byte(clusterGraph))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	renderer, err := NewRenderer("builtin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prefixes := map[string]string{
+		"svg": "<?xml",
+		"png": "\x89PNG",
+		"jpg": "\xff\xd8",
+		"pdf": "%PDF-",
+	}
+	for format, prefix := range prefixes {
+		var output bytes.Buffer
+		if err := renderer.Render(context.Background(), graph, format, &output); err != nil {
+			t.Fatalf("rendering %s: %v", format, err)
+		}
+		if !bytes.HasPrefix(output.Bytes(), []byte(prefix)) {
+			t.Errorf("%s output starts with %q", format, output.Bytes()[:8])
+		}
+	}
+}
+
+func TestRasterizeDrawsStrokes(t *testing.T) {
+	graph, err := gographviz.Read([]byte(clusterGraph))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var output bytes.Buffer
+	if err := (&BuiltinRenderer{}).Render(context.Background(), graph, "png", &output); err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(&output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Cluster border, node outlines and the edge are drawn in black
+	dark := 0
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			if r, g, b, _ := img.At(x, y).RGBA(); r < 0x4000 && g < 0x4000 && b < 0x4000 {
+				dark++
+			}
+		}
+	}
+	if dark < bounds.Dx()*2 {
+		t.Errorf("only %d dark pixels, strokes are missing", dark)
+	}
+}
+
+func TestSaveGraphAsDOTIsDeterministic(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "diagram.dot")
+	var written [][]byte
+	for i := 0; i < 2; i++ {
+		// Every run writes its images to a new temporary directory
+		images := t.TempDir()
+		if err := os.WriteFile(filepath.Join(images, "subnet.png"), []byte("icon"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		graph, err := gographviz.Read([]byte(clusterGraph))
+		if err != nil {
+			t.Fatal(err)
+		}
+		graph.Attrs["imagepath"] = `"` + images + `"`
+		graph.Nodes.Lookup[`"azurerm_subnet.web"`].Attrs["image"] = `"subnet.png"`
+
+		if err := SaveGraphAs(graph, output, []string{"dot"}, &BuiltinRenderer{}, nil); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		written = append(written, data)
+		if strings.Contains(string(data), images) {
+			t.Errorf("DOT holds the temporary image directory %s", images)
+		}
+	}
+
+	if !bytes.Equal(written[0], written[1]) {
+		t.Errorf("DOT differs between runs:\n%s\n%s", written[0], written[1])
+	}
+	if !strings.Contains(string(written[0]), `imagepath="icons"`) {
+		t.Errorf("DOT has no relative image path:\n%s", written[0])
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(output), "icons", "subnet.png")); err != nil {
+		t.Errorf("icon was not copied next to the DOT file: %v", err)
+	}
+}
+
+func TestNewRendererRejectsUnknownNames(t *testing.T) {
+	if _, err := NewRenderer("cairo"); err == nil {
+		t.Error("NewRenderer(cairo) returned no error")
+	}
+}
+
+func TestOutputPath(t *testing.T) {
+	now := time.Date(2024, 6, 14, 17, 26, 36, 0, time.UTC)
+	tests := map[string]string{
+		DefaultOutput:                "diagram.mmd",
+		"docs/infra.mmd":             "docs/infra.mmd",
+		"diagram_{timestamp}.{ext}":  "diagram_20240614_172636.mmd",
+		"out/{format}/diagram.{ext}": "out/mermaid/diagram.mmd",
+	}
+	for template, want := range tests {
+		if got := OutputPath(template, "mermaid", now); got != want {
+			t.Errorf("OutputPath(%q) = %q, want %q", template, got, want)
+		}
+	}
+}
+
+func TestCheckOutput(t *testing.T) {
+	valid := []struct {
+		output  string
+		formats []string
+	}{
+		{DefaultOutput, []string{"png", "svg", "dot"}},
+		{"-", []string{"dot"}},
+		{"docs/infra.png", []string{"png"}},
+	}
+	for _, test := range valid {
+		if err := CheckOutput(test.output, test.formats); err != nil {
+			t.Errorf("CheckOutput(%q, %v): %v", test.output, test.formats, err)
+		}
+	}
+
+	invalid := []struct {
+		output  string
+		formats []string
+	}{
+		{DefaultOutput, []string{"gif"}},
+		{DefaultOutput, nil},
+		{"-", []string{"png", "svg"}},
+		{"docs/infra.png", []string{"png", "svg"}},
+	}
+	for _, test := range invalid {
+		if err := CheckOutput(test.output, test.formats); err == nil {
+			t.Errorf("CheckOutput(%q, %v) should fail", test.output, test.formats)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package render
+
+import (
+	"encoding/base64"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// imageHref matches the image references Graphviz writes into SVG.
+var imageHref = regexp.MustCompile(`xlink:href="([^"]+)"`)
+
+// inlineImages replaces the image files an SVG references by data URIs, looking relative paths up in dir.
+// References which are URLs or can not be read are kept.
+func inlineImages(svg []byte, dir string) []byte {
+	return imageHref.ReplaceAllFunc(svg, func(match []byte) []byte {
+		path := string(imageHref.FindSubmatch(match)[1])
+		if strings.Contains(path, "://") || strings.HasPrefix(path, "data:") {
+			return match
+		}
+		if !filepath.IsAbs(path) && dir != "" {
+			path = filepath.Join(dir, path)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return match
+		}
+		uri := "data:" + http.DetectContentType(data) + ";base64," + base64.StdEncoding.EncodeToString(data)
+		return []byte(`xlink:href="` + uri + `"`)
+	})
+}
@@ -0,0 +1,73 @@
+package render
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/CiucurDaniel/terraview/internal/address"
+	"github.com/awalterschulze/gographviz"
+)
+
+// children returns the nodes and subgraphs directly inside every graph and subgraph, sorted by name.
+// Something listed in several subgraphs is kept in the first one only, so every node is written once.
+func children(graph *gographviz.Graph) map[string][]string {
+	result := make(map[string][]string)
+	names := make([]string, 0, len(graph.Nodes.Nodes)+len(graph.SubGraphs.SubGraphs))
+	for _, node := range graph.Nodes.Nodes {
+		names = append(names, node.Name)
+	}
+	for name := range graph.SubGraphs.SubGraphs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		parent := graph.Name
+		var parents []string
+		for p := range graph.Relations.ChildToParents[name] {
+			if p != graph.Name && p != name {
+				parents = append(parents, p)
+			}
+		}
+		if len(parents) > 0 {
+			sort.Strings(parents)
+			parent = parents[0]
+		}
+		result[parent] = append(result[parent], name)
+	}
+	return result
+}
+
+// groupingCluster returns the cluster a grouping node, which has no label of its own, is drawn as.
+func groupingCluster(graph *gographviz.Graph, node *gographviz.Node) (string, bool) {
+	if labelText(node.Attrs["label"]) != "" {
+		return "", false
+	}
+	cluster := address.Quote("cluster_" + address.Unquote(node.Name))
+	return cluster, graph.IsSubGraph(cluster)
+}
+
+// labelText turns a DOT label into plain text, line breaks become newlines.
+func labelText(label string) string {
+	label = address.Unquote(label)
+	replacer := strings.NewReplacer(`\n`, "\n", `\l`, "\n", `\r`, "\n")
+	return strings.TrimRight(replacer.Replace(label), "\n")
+}
+
+// visibleEdges returns the edges which are drawn, once per pair of nodes.
+func visibleEdges(graph *gographviz.Graph) []*gographviz.Edge {
+	seen := make(map[[2]string]bool)
+	var edges []*gographviz.Edge
+	for _, edge := range graph.Edges.Sorted() {
+		if address.Unquote(edge.Attrs["style"]) == "invis" {
+			continue
+		}
+		key := [2]string{edge.Src, edge.Dst}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		edges = append(edges, edge)
+	}
+	return edges
+}
@@ -0,0 +1,548 @@
+package tfconfigreader
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/CiucurDaniel/terraview/internal/address"
+	"github.com/CiucurDaniel/terraview/internal/dag"
+	"github.com/awalterschulze/gographviz"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclparse"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// Module holds the blocks of a single Terraform module directory that are relevant for building the graph.
+type Module struct {
+	Dir         string
+	Resources   map[string][]hcl.Traversal // "aws_instance.web" -> references
+	DataSources map[string][]hcl.Traversal // "data.aws_ami.ubuntu" -> references
+	Variables   map[string]bool
+	Locals      map[string][]hcl.Traversal
+	Outputs     map[string][]hcl.Traversal
+	ModuleCalls map[string]*ModuleCall
+	Expansions  map[string]*Expansion // resources and data sources using count or for_each
+}
+
+// Expansion records the count or for_each argument of a resource.
+type Expansion struct {
+	Kind string // "count" or "for_each"
+	Expr hcl.Expression
+}
+
+// ModuleCall describes a "module" block and, when its source is a local path, the parsed child module.
+type ModuleCall struct {
+	Name       string
+	Source     string
+	Inputs     map[string][]hcl.Traversal
+	References []hcl.Traversal // count, for_each, depends_on and providers
+	Child      *Module
+}
+
+// LoadModule parses every *.tf file in dirPath and recursively loads modules called with a local source.
+func LoadModule(dirPath string) (*Module, error) {
+	return loadModule(dirPath, map[string]bool{})
+}
+
+func loadModule(dirPath string, loading map[string]bool) (*Module, error) {
+	absDirPath, err := filepath.Abs(dirPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path for directory: %v", err)
+	}
+	if loading[absDirPath] {
+		return nil, fmt.Errorf("module %s calls itself", absDirPath)
+	}
+	loading[absDirPath] = true
+	defer delete(loading, absDirPath)
+
+	files, err := filepath.Glob(filepath.Join(absDirPath, "*.tf"))
+	if err != nil {
+		return nil, fmt.Errorf("error listing terraform files in %s: %v", absDirPath, err)
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no terraform files found in %s", absDirPath)
+	}
+	sort.Strings(files)
+
+	mod := &Module{
+		Dir:         absDirPath,
+		Resources:   make(map[string][]hcl.Traversal),
+		DataSources: make(map[string][]hcl.Traversal),
+		Variables:   make(map[string]bool),
+		Locals:      make(map[string][]hcl.Traversal),
+		Outputs:     make(map[string][]hcl.Traversal),
+		ModuleCalls: make(map[string]*ModuleCall),
+		Expansions:  make(map[string]*Expansion),
+	}
+
+	parser := hclparse.NewParser()
+	for _, file := range files {
+		f, diags := parser.ParseHCLFile(file)
+		if diags.HasErrors() {
+			return nil, fmt.Errorf("error parsing %s: %v", file, diags)
+		}
+
+		body, ok := f.Body.(*hclsyntax.Body)
+		if !ok {
+			continue
+		}
+
+		for _, block := range body.Blocks {
+			switch block.Type {
+			case "resource":
+				if len(block.Labels) == 2 {
+					address := block.Labels[0] + "." + block.Labels[1]
+					mod.Resources[address] = collectReferences(block.Body)
+					recordExpansion(mod, address, block.Body)
+				}
+			case "data":
+				if len(block.Labels) == 2 {
+					address := "data." + block.Labels[0] + "." + block.Labels[1]
+					mod.DataSources[address] = collectReferences(block.Body)
+					recordExpansion(mod, address, block.Body)
+				}
+			case "variable":
+				if len(block.Labels) == 1 {
+					mod.Variables[block.Labels[0]] = true
+				}
+			case "locals":
+				for name, attr := range block.Body.Attributes {
+					mod.Locals[name] = attr.Expr.Variables()
+				}
+			case "output":
+				if len(block.Labels) == 1 {
+					mod.Outputs[block.Labels[0]] = collectReferences(block.Body)
+				}
+			case "module":
+				if len(block.Labels) == 1 {
+					call, err := loadModuleCall(absDirPath, block, loading)
+					if err != nil {
+						return nil, err
+					}
+					mod.ModuleCalls[call.Name] = call
+				}
+			}
+		}
+	}
+
+	return mod, nil
+}
+
+// recordExpansion remembers the count or for_each argument of a resource block, if any.
+func recordExpansion(mod *Module, address string, body *hclsyntax.Body) {
+	for _, kind := range []string{"count", "for_each"} {
+		if attr, ok := body.Attributes[kind]; ok {
+			mod.Expansions[address] = &Expansion{Kind: kind, Expr: attr.Expr}
+		}
+	}
+}
+
+// metaArguments are module block arguments that are not input variables of the called module.
+var metaArguments = map[string]bool{
+	"source":     true,
+	"version":    true,
+	"count":      true,
+	"for_each":   true,
+	"depends_on": true,
+	"providers":  true,
+}
+
+func loadModuleCall(dirPath string, block *hclsyntax.Block, loading map[string]bool) (*ModuleCall, error) {
+	call := &ModuleCall{
+		Name:   block.Labels[0],
+		Inputs: make(map[string][]hcl.Traversal),
+	}
+
+	for name, attr := range block.Body.Attributes {
+		if name == "source" {
+			value, diags := attr.Expr.Value(nil)
+			if !diags.HasErrors() && value.Type() == cty.String {
+				call.Source = value.AsString()
+			}
+			continue
+		}
+		if metaArguments[name] {
+			call.References = append(call.References, attr.Expr.Variables()...)
+			continue
+		}
+		call.Inputs[name] = attr.Expr.Variables()
+	}
+
+	// Only modules living next to the configuration can be read without "terraform init"
+	if isLocalSource(call.Source) {
+		child, err := loadModule(filepath.Join(dirPath, call.Source), loading)
+		if err != nil {
+			return nil, fmt.Errorf("error loading module %s: %v", call.Name, err)
+		}
+		call.Child = child
+	}
+
+	return call, nil
+}
+
+// isLocalSource checks if a module source points to a directory on disk.
+func isLocalSource(source string) bool {
+	return strings.HasPrefix(source, "./") || strings.HasPrefix(source, "../") ||
+		strings.HasPrefix(source, ".\\") || strings.HasPrefix(source, "..\\")
+}
+
+// collectReferences returns every variable traversal found in the attributes and nested blocks of a body.
+func collectReferences(body *hclsyntax.Body) []hcl.Traversal {
+	var references []hcl.Traversal
+	for _, attr := range body.Attributes {
+		references = append(references, attr.Expr.Variables()...)
+	}
+	for _, block := range body.Blocks {
+		references = append(references, collectReferences(block.Body)...)
+	}
+	return references
+}
+
+// moduleInstance is a module placed in the tree of module calls, e.g. "module.network." under the root.
+type moduleInstance struct {
+	module *Module
+	prefix string
+	parent *moduleInstance
+	call   *ModuleCall
+}
+
+// BuildGraph parses the configuration in dirPath and returns a graph with the same shape "terraform graph" produces:
+// one node per resource, data source and remote module call, with an edge from every node to each node it depends on.
+// References through variables, locals, outputs and local modules are followed until they reach such a node.
+func BuildGraph(dirPath string) (*gographviz.Graph, error) {
+	root, err := LoadModule(dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	graph := gographviz.NewGraph()
+	if err := graph.SetName("G"); err != nil {
+		return nil, err
+	}
+	if err := graph.SetDir(true); err != nil {
+		return nil, err
+	}
+	graph.Attrs["rankdir"] = `"RL"`
+
+	resolver := &resolver{visiting: make(map[string]bool)}
+
+	var instances []*moduleInstance
+	var walk func(inst *moduleInstance)
+	walk = func(inst *moduleInstance) {
+		instances = append(instances, inst)
+		for _, name := range address.SortedKeys(inst.module.ModuleCalls) {
+			call := inst.module.ModuleCalls[name]
+			if call.Child != nil {
+				walk(&moduleInstance{
+					module: call.Child,
+					prefix: inst.prefix + "module." + name + ".",
+					parent: inst,
+					call:   call,
+				})
+			}
+		}
+	}
+	walk(&moduleInstance{module: root})
+
+	// Add the nodes first so edges never reference an unknown node
+	for _, inst := range instances {
+		for _, node := range nodeAddresses(inst) {
+			if err := graph.AddNode("G", address.Quote(inst.prefix+node), map[string]string{"label": address.Quote(inst.prefix + node)}); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	edges := make(map[string]map[string]bool)
+	for _, inst := range instances {
+		dependencies := make(map[string][]hcl.Traversal)
+		for address, refs := range inst.module.Resources {
+			dependencies[address] = refs
+		}
+		for address, refs := range inst.module.DataSources {
+			dependencies[address] = refs
+		}
+		for name, call := range inst.module.ModuleCalls {
+			if call.Child == nil {
+				var refs []hcl.Traversal
+				for _, input := range call.Inputs {
+					refs = append(refs, input...)
+				}
+				dependencies["module."+name] = append(refs, call.References...)
+			}
+		}
+
+		for _, address := range address.SortedKeys(dependencies) {
+			src := inst.prefix + address
+			targets := make(map[string]bool)
+			for _, ref := range dependencies[address] {
+				for _, target := range resolver.resolve(inst, ref) {
+					targets[target] = true
+				}
+			}
+			// Resources inside a local module also depend on whatever the module call itself depends on
+			for cur := inst; cur.call != nil; cur = cur.parent {
+				for _, ref := range cur.call.References {
+					for _, target := range resolver.resolve(cur.parent, ref) {
+						targets[target] = true
+					}
+				}
+			}
+			delete(targets, src)
+			edges[src] = targets
+		}
+	}
+
+	dag.ReduceTransitively(edges)
+	for _, src := range address.SortedKeys(edges) {
+		for _, dst := range address.SortedKeys(edges[src]) {
+			if err := graph.AddEdge(address.Quote(src), address.Quote(dst), true, nil); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return graph, nil
+}
+
+// nodeAddresses lists the module relative addresses that become nodes for a module instance.
+func nodeAddresses(inst *moduleInstance) []string {
+	var addresses []string
+	addresses = append(addresses, address.SortedKeys(inst.module.Resources)...)
+	addresses = append(addresses, address.SortedKeys(inst.module.DataSources)...)
+	for _, name := range address.SortedKeys(inst.module.ModuleCalls) {
+		if inst.module.ModuleCalls[name].Child == nil {
+			addresses = append(addresses, "module."+name)
+		}
+	}
+	return addresses
+}
+
+// resolver follows references through variables, locals, outputs and module calls down to graph nodes.
+type resolver struct {
+	visiting map[string]bool
+}
+
+func (r *resolver) resolve(inst *moduleInstance, ref hcl.Traversal) []string {
+	parts := traversalNames(ref)
+	if len(parts) == 0 {
+		return nil
+	}
+
+	// Guard against cycles between locals, variables and outputs
+	key := inst.prefix + strings.Join(parts, ".")
+	if r.visiting[key] {
+		return nil
+	}
+	r.visiting[key] = true
+	defer delete(r.visiting, key)
+
+	mod := inst.module
+	switch parts[0] {
+	case "var":
+		if len(parts) < 2 || inst.call == nil {
+			return nil
+		}
+		return r.resolveAll(inst.parent, inst.call.Inputs[parts[1]])
+	case "local":
+		if len(parts) < 2 {
+			return nil
+		}
+		return r.resolveAll(inst, mod.Locals[parts[1]])
+	case "data":
+		if len(parts) < 3 {
+			return nil
+		}
+		address := "data." + parts[1] + "." + parts[2]
+		if _, ok := mod.DataSources[address]; ok {
+			return []string{inst.prefix + address}
+		}
+	case "module":
+		if len(parts) < 2 {
+			return nil
+		}
+		call, ok := mod.ModuleCalls[parts[1]]
+		if !ok {
+			return nil
+		}
+		if call.Child == nil {
+			return []string{inst.prefix + "module." + call.Name}
+		}
+		child := &moduleInstance{
+			module: call.Child,
+			prefix: inst.prefix + "module." + call.Name + ".",
+			parent: inst,
+			call:   call,
+		}
+		if len(parts) > 2 {
+			return r.resolveAll(child, call.Child.Outputs[parts[2]])
+		}
+		var targets []string
+		for _, name := range address.SortedKeys(call.Child.Outputs) {
+			targets = append(targets, r.resolveAll(child, call.Child.Outputs[name])...)
+		}
+		return targets
+	case "count", "each", "path", "self", "terraform":
+		return nil
+	default:
+		if len(parts) < 2 {
+			return nil
+		}
+		address := parts[0] + "." + parts[1]
+		if _, ok := mod.Resources[address]; ok {
+			return []string{inst.prefix + address}
+		}
+	}
+
+	return nil
+}
+
+func (r *resolver) resolveAll(inst *moduleInstance, refs []hcl.Traversal) []string {
+	var targets []string
+	for _, ref := range refs {
+		targets = append(targets, r.resolve(inst, ref)...)
+	}
+	return targets
+}
+
+// traversalNames returns the leading names of a traversal, stopping at the first index step.
+func traversalNames(traversal hcl.Traversal) []string {
+	var names []string
+	for _, step := range traversal {
+		switch s := step.(type) {
+		case hcl.TraverseRoot:
+			names = append(names, s.Name)
+		case hcl.TraverseAttr:
+			names = append(names, s.Name)
+		default:
+			// Skip the instance key of a module call, e.g. module.x[0].output
+			if len(names) == 2 && names[0] == "module" {
+				continue
+			}
+			return names
+		}
+	}
+	return names
+}
+
+// Declaration is a resource or data source declared somewhere in the module tree.
+type Declaration struct {
+	Address   string     // e.g. module.network.azurerm_subnet.this
+	Expansion *Expansion // nil when neither count nor for_each is used
+}
+
+// ExpectedKeys evaluates a literal count or for_each and returns the instance keys in state notation,
+// e.g. 0 and 1 for count = 2 or "web" for for_each = { web = "10.0.1.0/24" }. It returns false when the keys
+// depend on values which are only known to terraform, like variables or other resources.
+func (d Declaration) ExpectedKeys() ([]string, bool) {
+	if d.Expansion == nil {
+		return nil, true
+	}
+
+	value, diags := d.Expansion.Expr.Value(nil)
+	if diags.HasErrors() || !value.IsWhollyKnown() || value.IsNull() {
+		return nil, false
+	}
+
+	var keys []string
+	switch {
+	case d.Expansion.Kind == "count" && value.Type() == cty.Number:
+		count, _ := value.AsBigFloat().Int64()
+		for i := int64(0); i < count; i++ {
+			keys = append(keys, fmt.Sprintf("%d", i))
+		}
+	case d.Expansion.Kind == "for_each" && (value.Type().IsMapType() || value.Type().IsObjectType()):
+		for key := range value.AsValueMap() {
+			keys = append(keys, fmt.Sprintf("%q", key))
+		}
+	case d.Expansion.Kind == "for_each" && (value.Type().IsSetType() || value.Type().IsTupleType()):
+		for _, element := range value.AsValueSlice() {
+			if element.Type() != cty.String {
+				return nil, false
+			}
+			keys = append(keys, fmt.Sprintf("%q", element.AsString()))
+		}
+	default:
+		return nil, false
+	}
+
+	sort.Strings(keys)
+	return keys, true
+}
+
+// Declarations lists every resource and data source declared in the module and its local child modules.
+// The second result holds the address prefixes of module calls whose source could not be read, like
+// registry modules, so callers can ignore resources living inside them.
+func Declarations(root *Module) ([]Declaration, []string) {
+	var declarations []Declaration
+	var opaque []string
+
+	var walk func(mod *Module, prefix string)
+	walk = func(mod *Module, prefix string) {
+		for _, resource := range address.SortedKeys(mod.Resources) {
+			declarations = append(declarations, Declaration{Address: prefix + resource, Expansion: mod.Expansions[resource]})
+		}
+		for _, resource := range address.SortedKeys(mod.DataSources) {
+			declarations = append(declarations, Declaration{Address: prefix + resource, Expansion: mod.Expansions[resource]})
+		}
+		for _, name := range address.SortedKeys(mod.ModuleCalls) {
+			call := mod.ModuleCalls[name]
+			if call.Child == nil {
+				opaque = append(opaque, prefix+"module."+name+".")
+				continue
+			}
+			walk(call.Child, prefix+"module."+name+".")
+		}
+	}
+	walk(root, "")
+
+	return declarations, opaque
+}
+
+// Interface returns the sorted input and output names of the module called at modulePath,
+// e.g. module.network.module.subnets. Outputs are only known for modules with a local source.
+func Interface(root *Module, modulePath string) ([]string, []string, bool) {
+	mod := root
+	var call *ModuleCall
+	for _, step := range strings.Split(modulePath, ".module.") {
+		if mod == nil {
+			return nil, nil, false
+		}
+		var ok bool
+		call, ok = mod.ModuleCalls[strings.TrimPrefix(step, "module.")]
+		if !ok {
+			return nil, nil, false
+		}
+		mod = call.Child
+	}
+
+	var outputs []string
+	if call.Child != nil {
+		outputs = address.SortedKeys(call.Child.Outputs)
+	}
+	return address.SortedKeys(call.Inputs), outputs, true
+}
+
+// ResourceTypes returns the sorted types of all resources and data sources in the module and its local child modules.
+func (m *Module) ResourceTypes() []string {
+	seen := make(map[string]bool)
+	var collect func(mod *Module)
+	collect = func(mod *Module) {
+		for _, addresses := range []map[string][]hcl.Traversal{mod.Resources, mod.DataSources} {
+			for address := range addresses {
+				parts := strings.Split(strings.TrimPrefix(address, "data."), ".")
+				seen[parts[0]] = true
+			}
+		}
+		for _, call := range mod.ModuleCalls {
+			if call.Child != nil {
+				collect(call.Child)
+			}
+		}
+	}
+	collect(m)
+	return address.SortedKeys(seen)
+}
@@ -0,0 +1,42 @@
+package tfconfigreader_test
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/CiucurDaniel/terraview/internal/graph"
+	"github.com/CiucurDaniel/terraview/internal/tfconfigreader"
+	"github.com/awalterschulze/gographviz"
+)
+
+func edgeSet(g *gographviz.Graph) []string {
+	var edges []string
+	for _, edge := range g.Edges.Edges {
+		edges = append(edges, edge.Src+" -> "+edge.Dst)
+	}
+	sort.Strings(edges)
+	return edges
+}
+
+// The example ships the output of terraform graph, reading its configuration must give the same dependencies.
+func TestBuildGraphMatchesTerraformGraph(t *testing.T) {
+	data, err := os.ReadFile("../../3-tier-arhitecture/plan.dot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := graph.ParseGraph(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := tfconfigreader.BuildGraph("../../3-tier-arhitecture")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(edgeSet(got), edgeSet(want)) {
+		t.Errorf("edges = %v, want %v", edgeSet(got), edgeSet(want))
+	}
+}
@@ -0,0 +1,111 @@
+package tfplanreader
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// Actions a resource change can resolve to, in the order they are shown in the legend.
+const (
+	ActionCreate  = "create"
+	ActionUpdate  = "update"
+	ActionReplace = "replace"
+	ActionDelete  = "delete"
+	ActionRead    = "read"
+	ActionNoOp    = "no-op"
+)
+
+// AllActions lists every action in legend order.
+var AllActions = []string{ActionCreate, ActionUpdate, ActionReplace, ActionDelete, ActionRead, ActionNoOp}
+
+// Plan holds the parts of the "terraform show -json" output that are relevant for the diagram.
+type Plan struct {
+	FormatVersion   string           `json:"format_version"`
+	ResourceChanges []ResourceChange `json:"resource_changes"`
+}
+
+// ResourceChange describes the planned change of a single resource instance.
+type ResourceChange struct {
+	Address       string          `json:"address"`
+	ModuleAddress string          `json:"module_address"`
+	Mode          string          `json:"mode"`
+	Type          string          `json:"type"`
+	Name          string          `json:"name"`
+	Index         json.RawMessage `json:"index"`
+	Change        Change          `json:"change"`
+}
+
+// Change holds the actions terraform will take for a resource instance.
+type Change struct {
+	Actions []string `json:"actions"`
+}
+
+// Action collapses the list of actions of a change into a single action.
+// ["delete", "create"] and ["create", "delete"] both mean the resource is replaced.
+func (c ResourceChange) Action() string {
+	actions := c.Change.Actions
+	switch {
+	case len(actions) == 2:
+		return ActionReplace
+	case len(actions) == 1:
+		return actions[0]
+	default:
+		return ActionNoOp
+	}
+}
+
+// LoadPlan reads a plan. planPath may point to a JSON file exported with "terraform show -json"
+// or to a binary plan file, in which case "terraform show -json" is run in dirPath to convert it.
+func LoadPlan(planPath, dirPath string) (*Plan, error) {
+	data, err := os.ReadFile(planPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading plan file: %v", err)
+	}
+
+	if !json.Valid(data) {
+		data, err = showPlan(planPath, dirPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var plan Plan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, fmt.Errorf("error parsing plan: %v", err)
+	}
+	if plan.FormatVersion == "" {
+		return nil, fmt.Errorf("%s is not a plan exported with terraform show -json", planPath)
+	}
+
+	return &plan, nil
+}
+
+// showPlan converts a binary plan file to JSON by invoking "terraform show -json".
+func showPlan(planPath, dirPath string) ([]byte, error) {
+	absPlanPath, err := filepath.Abs(planPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get absolute path for plan: %v", err)
+	}
+
+	terraformPath, err := exec.LookPath("terraform")
+	if err != nil {
+		return nil, fmt.Errorf("failed to find terraform executable in PATH: %v", err)
+	}
+
+	cmd := exec.Command(terraformPath, "show", "-json", absPlanPath)
+	cmd.Dir = dirPath
+
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("error running 'terraform show -json' in directory %s: %v, output: %s", dirPath, err, stderr.String())
+	}
+
+	return out.Bytes(), nil
+}
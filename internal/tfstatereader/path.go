@@ -0,0 +1,154 @@
+package tfstatereader
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/CiucurDaniel/terraview/internal/address"
+)
+
+// pathStep is one step of an attribute path: an attribute name, a list index, a map key or a splat.
+type pathStep struct {
+	Attr  string
+	Index int
+	Key   string
+	Kind  string // "attr", "index", "key" or "splat"
+}
+
+// parsePath parses attribute paths such as os_disk[0].storage_account_type, tags.environment,
+// tags["cost-center"] or ip_configuration[*].private_ip_address
+func parsePath(path string) ([]pathStep, error) {
+	var steps []pathStep
+	rest := path
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, "."):
+			rest = rest[1:]
+		case strings.HasPrefix(rest, "[*]"):
+			steps = append(steps, pathStep{Kind: "splat"})
+			rest = rest[3:]
+		case strings.HasPrefix(rest, `["`):
+			end := strings.Index(rest, `"]`)
+			if end < 0 {
+				return nil, fmt.Errorf("invalid attribute path %s: unterminated key", path)
+			}
+			steps = append(steps, pathStep{Kind: "key", Key: rest[2:end]})
+			rest = rest[end+2:]
+		case strings.HasPrefix(rest, "["):
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("invalid attribute path %s: unterminated index", path)
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("invalid attribute path %s: %v", path, err)
+			}
+			steps = append(steps, pathStep{Kind: "index", Index: index})
+			rest = rest[end+1:]
+		default:
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			steps = append(steps, pathStep{Kind: "attr", Attr: rest[:end]})
+			rest = rest[end:]
+		}
+	}
+
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("empty attribute path")
+	}
+	return steps, nil
+}
+
+// EvaluatePath returns the values found at the attribute path. Splats and attribute access on a list,
+// which is how nested blocks are stored in state, return one value per element.
+func EvaluatePath(value interface{}, path string) ([]interface{}, error) {
+	steps, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	values := []interface{}{value}
+	for _, step := range steps {
+		var next []interface{}
+		for _, v := range values {
+			next = append(next, applyStep(v, step)...)
+		}
+		values = next
+	}
+	return values, nil
+}
+
+func applyStep(value interface{}, step pathStep) []interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		switch step.Kind {
+		case "attr":
+			if found, ok := v[step.Attr]; ok && found != nil {
+				return []interface{}{found}
+			}
+		case "key":
+			if found, ok := v[step.Key]; ok && found != nil {
+				return []interface{}{found}
+			}
+		case "splat":
+			var result []interface{}
+			for _, key := range address.SortedKeys(v) {
+				result = append(result, v[key])
+			}
+			return result
+		}
+	case []interface{}:
+		switch step.Kind {
+		case "index":
+			if step.Index >= 0 && step.Index < len(v) {
+				return []interface{}{v[step.Index]}
+			}
+		case "splat":
+			return v
+		case "attr", "key":
+			var result []interface{}
+			for _, element := range v {
+				result = append(result, applyStep(element, step)...)
+			}
+			return result
+		}
+	}
+	return nil
+}
+
+// FormatValue formats a state value for a label: lists are comma joined, maps are written as k=v
+// and numbers are printed without exponent.
+func FormatValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case []interface{}:
+		parts := make([]string, 0, len(v))
+		for _, element := range v {
+			if formatted := FormatValue(element); formatted != "" {
+				parts = append(parts, formatted)
+			}
+		}
+		return strings.Join(parts, ", ")
+	case map[string]interface{}:
+		parts := make([]string, 0, len(v))
+		for _, key := range address.SortedKeys(v) {
+			if v[key] == nil {
+				continue
+			}
+			parts = append(parts, fmt.Sprintf("%s=%s", key, FormatValue(v[key])))
+		}
+		return strings.Join(parts, ", ")
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
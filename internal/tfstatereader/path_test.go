@@ -0,0 +1,84 @@
+package tfstatereader
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const vmAttributes = `{
+	"name": "ui-vm",
+	"size": "Standard_B1s",
+	"os_disk": [{"caching": "ReadWrite", "storage_account_type": "Standard_LRS"}],
+	"ip_configuration": [
+		{"name": "internal", "private_ip_address": "10.0.1.4"},
+		{"name": "public", "private_ip_address": "10.0.1.5"}
+	],
+	"tags": {"environment": "dev", "cost-center": "42"},
+	"zone": null
+}`
+
+func TestEvaluatePath(t *testing.T) {
+	var attributes map[string]interface{}
+	if err := json.Unmarshal([]byte(vmAttributes), &attributes); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		want []interface{}
+	}{
+		{"size", []interface{}{"Standard_B1s"}},
+		{"os_disk[0].storage_account_type", []interface{}{"Standard_LRS"}},
+		{"os_disk.caching", []interface{}{"ReadWrite"}},
+		{"ip_configuration[*].private_ip_address", []interface{}{"10.0.1.4", "10.0.1.5"}},
+		{"ip_configuration[1].name", []interface{}{"public"}},
+		{"tags.environment", []interface{}{"dev"}},
+		{`tags["cost-center"]`, []interface{}{"42"}},
+		{"tags[*]", []interface{}{"42", "dev"}},
+		{"os_disk[3].caching", nil},
+		{"zone", nil},
+		{"missing", nil},
+	}
+
+	for _, test := range tests {
+		got, err := EvaluatePath(attributes, test.path)
+		if err != nil {
+			t.Errorf("EvaluatePath(%s) returned error: %v", test.path, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("EvaluatePath(%s) = %v, want %v", test.path, got, test.want)
+		}
+	}
+}
+
+func TestEvaluatePathRejectsInvalidPaths(t *testing.T) {
+	for _, path := range []string{"", "os_disk[0", "os_disk[first]", `tags["environment`} {
+		if _, err := EvaluatePath(map[string]interface{}{}, path); err == nil {
+			t.Errorf("EvaluatePath(%s) returned no error", path)
+		}
+	}
+}
+
+func TestFormatValue(t *testing.T) {
+	tests := []struct {
+		value interface{}
+		want  string
+	}{
+		{nil, ""},
+		{"westeurope", "westeurope"},
+		{float64(1024), "1024"},
+		{float64(0.5), "0.5"},
+		{float64(12345678901), "12345678901"},
+		{true, "true"},
+		{[]interface{}{"10.0.0.0/16", nil, "10.1.0.0/16"}, "10.0.0.0/16, 10.1.0.0/16"},
+		{map[string]interface{}{"team": "web", "environment": "dev", "owner": nil}, "environment=dev, team=web"},
+	}
+
+	for _, test := range tests {
+		if got := FormatValue(test.value); got != test.want {
+			t.Errorf("FormatValue(%v) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
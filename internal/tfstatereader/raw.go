@@ -0,0 +1,196 @@
+package tfstatereader
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/CiucurDaniel/terraview/internal/address"
+	"github.com/CiucurDaniel/terraview/internal/dag"
+	"github.com/CiucurDaniel/terraview/internal/icons"
+	"github.com/awalterschulze/gographviz"
+)
+
+// RawState holds the parts of a version 4 state file which are not exposed by tfstate-lookup.
+type RawState struct {
+	Version   int             `json:"version"`
+	Backend   json.RawMessage `json:"backend"`
+	Resources []RawResource   `json:"resources"`
+}
+
+// RawResource is a resource entry of the state, holding one or more instances.
+type RawResource struct {
+	Module    string        `json:"module"`
+	Mode      string        `json:"mode"`
+	Type      string        `json:"type"`
+	Name      string        `json:"name"`
+	Provider  string        `json:"provider"`
+	Instances []RawInstance `json:"instances"`
+}
+
+// RawInstance is a single instance of a resource, keyed by count index or for_each key.
+type RawInstance struct {
+	IndexKey            json.RawMessage        `json:"index_key"`
+	Attributes          map[string]interface{} `json:"attributes"`
+	SensitiveAttributes json.RawMessage        `json:"sensitive_attributes"`
+	Dependencies        []string               `json:"dependencies"`
+}
+
+// Address returns the resource address without instance key, e.g. module.network.azurerm_subnet.this
+func (r RawResource) Address() string {
+	address := r.Type + "." + r.Name
+	if r.Mode == "data" {
+		address = "data." + address
+	}
+	if r.Module != "" {
+		address = r.Module + "." + address
+	}
+	return address
+}
+
+// InstanceAddress returns the address of an instance in the same notation tfstate-lookup lists them,
+// e.g. azurerm_subnet.this[0] or azurerm_subnet.this["web"]
+func (r RawResource) InstanceAddress(instance RawInstance) string {
+	if len(instance.IndexKey) == 0 {
+		return r.Address()
+	}
+	return r.Address() + "[" + string(instance.IndexKey) + "]"
+}
+
+// ProviderName returns the name of the provider a resource was created with, from the provider address
+// recorded in the state, e.g. kubernetes for provider["registry.terraform.io/hashicorp/kubernetes"].alias
+func (r RawResource) ProviderName() string {
+	source := strings.TrimPrefix(r.Provider, "provider[")
+	if end := strings.Index(source, "]"); end >= 0 {
+		source = source[:end]
+	}
+	source = strings.Trim(source, `"`)
+	return source[strings.LastIndex(source, "/")+1:]
+}
+
+// Providers returns the sorted names of the providers recorded in the state. Without the raw state
+// they are told by the prefix of the resource types.
+func (h *TFStateHandler) Providers() []string {
+	seen := make(map[string]bool)
+	if h.Raw != nil {
+		for _, res := range h.Raw.Resources {
+			if name := res.ProviderName(); name != "" {
+				seen[name] = true
+			}
+		}
+	} else if names, err := h.State.List(); err == nil {
+		for _, name := range names {
+			if addr, err := address.Parse(name); err == nil && !addr.IsModuleCall() {
+				seen[icons.Provider(addr.Type)] = true
+			}
+		}
+	}
+
+	return address.SortedKeys(seen)
+}
+
+// FindInstance returns the resource and instance the raw state records for an instance address,
+// e.g. module.net[0].azurerm_subnet.this["web"]. It reports false when there is no raw state or no such instance.
+func (h *TFStateHandler) FindInstance(resource string) (RawResource, RawInstance, bool) {
+	if h.Raw == nil {
+		return RawResource{}, RawInstance{}, false
+	}
+	for _, res := range h.Raw.Resources {
+		for _, instance := range res.Instances {
+			if res.InstanceAddress(instance) == resource {
+				return res, instance, true
+			}
+		}
+	}
+	return RawResource{}, RawInstance{}, false
+}
+
+// parseRawState decodes the raw state.
+func parseRawState(data []byte) (*RawState, error) {
+	var raw RawState
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid json: %v", err)
+	}
+	return &raw, nil
+}
+
+// BuildGraph builds a graph purely from the state: one node per resource instance and an edge from
+// every instance to all instances of the resources it depends on, as recorded in "dependencies".
+// Module paths are kept in the node names so the graph has the same shape as "terraform graph".
+func (h *TFStateHandler) BuildGraph() (*gographviz.Graph, error) {
+	if h.Raw == nil {
+		return nil, fmt.Errorf("state %s was not read", h.StateFilePath)
+	}
+	if len(h.Raw.Resources) == 0 {
+		return nil, fmt.Errorf("state %s contains no resources", h.StateFilePath)
+	}
+
+	graph := gographviz.NewGraph()
+	if err := graph.SetName("G"); err != nil {
+		return nil, err
+	}
+	if err := graph.SetDir(true); err != nil {
+		return nil, err
+	}
+	graph.Attrs["rankdir"] = `"RL"`
+
+	// Map every resource to its instances by the address terraform records in dependencies, which has no module keys
+	instances := make(map[string][]address.Address)
+	for _, resource := range h.Raw.Resources {
+		for _, instance := range resource.Instances {
+			addr, err := address.Parse(resource.InstanceAddress(instance))
+			if err != nil {
+				return nil, err
+			}
+			config := addr.WithoutModuleKeys().WithoutKey().String()
+			instances[config] = append(instances[config], addr)
+		}
+	}
+
+	edges := make(map[string]map[string]bool)
+	for _, resource := range h.Raw.Resources {
+		for _, instance := range resource.Instances {
+			src := resource.InstanceAddress(instance)
+			srcAddr, _ := address.Parse(src)
+			edges[src] = make(map[string]bool)
+			for _, dependency := range instance.Dependencies {
+				// An instance of an expanded module only depends on the instances of its own module instance
+				for _, dst := range instances[dependency] {
+					if dst.String() != src && srcAddr.SameModuleInstances(dst) {
+						edges[src][dst.String()] = true
+					}
+				}
+			}
+		}
+	}
+
+	// Terraform records transitive dependencies too, keep only the direct ones
+	dag.ReduceTransitively(edges)
+
+	nodes := make([]string, 0, len(edges))
+	for node := range edges {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+
+	for _, node := range nodes {
+		if err := graph.AddNode("G", address.Quote(node), map[string]string{"label": address.Quote(node)}); err != nil {
+			return nil, err
+		}
+	}
+	for _, src := range nodes {
+		targets := make([]string, 0, len(edges[src]))
+		for dst := range edges[src] {
+			targets = append(targets, dst)
+		}
+		sort.Strings(targets)
+		for _, dst := range targets {
+			if err := graph.AddEdge(address.Quote(src), address.Quote(dst), true, nil); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return graph, nil
+}
@@ -0,0 +1,88 @@
+package tfstatereader
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/CiucurDaniel/terraview/internal/address"
+)
+
+// Reference is an attribute of an instance holding the id of another instance, e.g. the subnet_id of a network
+// interface holding the id of a subnet.
+type Reference struct {
+	From      string // address of the instance holding the id
+	To        string // address of the instance the id belongs to
+	Attribute string // name of the attribute holding the id, e.g. subnet_id or network_interface_ids
+}
+
+// References finds the references between the instances of the state by value: the id of every instance is
+// indexed and the attributes of all instances, nested blocks and lists included, are compared with them.
+// Ids are compared case-insensitively, like Azure does, and ids shared by several instances, like a resource and
+// a data source reading it, are ignored. References are sorted and found once per attribute.
+func (h *TFStateHandler) References() ([]Reference, error) {
+	names, err := h.State.List()
+	if err != nil {
+		return nil, fmt.Errorf("error listing resources: %v", err)
+	}
+	sort.Strings(names)
+
+	attributes := make(map[string]map[string]interface{})
+	owners := make(map[string][]string)
+	for _, name := range names {
+		obj, err := h.State.Lookup(name)
+		if err != nil {
+			continue
+		}
+		values, ok := obj.Value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		attributes[name] = values
+		if id, ok := values["id"].(string); ok && id != "" {
+			owners[strings.ToLower(id)] = append(owners[strings.ToLower(id)], name)
+		}
+	}
+
+	var references []Reference
+	seen := make(map[Reference]bool)
+	for _, name := range names {
+		for _, key := range address.SortedKeys(attributes[name]) {
+			// The id of the instance itself
+			if key == "id" {
+				continue
+			}
+			walkStrings(attributes[name][key], key, func(attribute, value string) {
+				owner := owners[strings.ToLower(value)]
+				if len(owner) != 1 || owner[0] == name {
+					return
+				}
+				reference := Reference{From: name, To: owner[0], Attribute: attribute}
+				if !seen[reference] {
+					seen[reference] = true
+					references = append(references, reference)
+				}
+			})
+		}
+	}
+	return references, nil
+}
+
+// walkStrings calls fn with every string found in value, together with the name of the innermost attribute
+// holding it, e.g. subnet_id for ip_configuration[0].subnet_id
+func walkStrings(value interface{}, attribute string, fn func(attribute, value string)) {
+	switch v := value.(type) {
+	case string:
+		if v != "" {
+			fn(attribute, v)
+		}
+	case []interface{}:
+		for _, item := range v {
+			walkStrings(item, attribute, fn)
+		}
+	case map[string]interface{}:
+		for _, key := range address.SortedKeys(v) {
+			walkStrings(v[key], key, fn)
+		}
+	}
+}
@@ -0,0 +1,375 @@
+package tfstatereader
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	tfe "github.com/hashicorp/go-tfe"
+	"google.golang.org/api/option"
+)
+
+// defaultWorkspace is the workspace used when none is selected, its state is not stored under a workspace prefix.
+const defaultWorkspace = "default"
+
+// readStateBytes reads the state document from a local path or one of the URL schemes tfstate-lookup supports,
+// http(s), s3, gs, azurerm, remote and file, with the same backend clients. A local file which only points to a
+// backend, like .terraform/terraform.tfstate, is followed to the backend with the workspace selected next to it.
+// The document is read once and parsed both by tfstate-lookup and as RawState.
+func readStateBytes(ctx context.Context, location string) ([]byte, error) {
+	if !isURL(location) && !strings.HasPrefix(location, "file://") {
+		return readLocalState(ctx, location)
+	}
+
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, err
+	}
+
+	var src io.ReadCloser
+	switch u.Scheme {
+	case "file":
+		return readLocalState(ctx, u.Path)
+	case "http", "https":
+		src, err = readHTTP(ctx, u.String(), "")
+	case "s3":
+		src, err = readS3(ctx, u.Host, strings.TrimPrefix(u.Path, "/"), "", "")
+	case "gs":
+		src, err = readGCS(ctx, u.Host, strings.TrimPrefix(u.Path, "/"), "", os.Getenv("GOOGLE_ENCRYPTION_KEY"))
+	case "azurerm":
+		split := strings.SplitN(u.Path, "/", 4)
+		if len(split) < 4 {
+			return nil, fmt.Errorf("invalid azurerm url: %s", u.String())
+		}
+		src, err = readAzureRM(ctx, u.Host, split[1], split[2], split[3], azureRMOptions{subscriptionID: u.User.Username()})
+	case "remote":
+		split := strings.Split(u.Path, "/")
+		if len(split) < 3 {
+			return nil, fmt.Errorf("invalid remote url: %s", u.String())
+		}
+		src, err = readTFE(ctx, u.Host, split[1], split[2], os.Getenv("TFE_TOKEN"))
+	default:
+		return nil, fmt.Errorf("URL scheme %s is not supported", u.Scheme)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tfstate from %s: %v", u.String(), err)
+	}
+	defer src.Close()
+
+	data, err := io.ReadAll(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tfstate from %s: %v", u.String(), err)
+	}
+	return data, nil
+}
+
+// readLocalState reads a state file, following it to its backend when it only points to one.
+func readLocalState(ctx context.Context, location string) ([]byte, error) {
+	data, err := os.ReadFile(location)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tfstate from %s: %v", location, err)
+	}
+
+	var pointer struct {
+		Backend *struct {
+			Type   string                 `json:"type"`
+			Config map[string]interface{} `json:"config"`
+		} `json:"backend"`
+	}
+	if err := json.Unmarshal(data, &pointer); err != nil || pointer.Backend == nil {
+		return data, nil
+	}
+
+	// The workspace selected with "terraform workspace select" is recorded next to the pointer
+	workspace := defaultWorkspace
+	if selected, err := os.ReadFile(filepath.Join(filepath.Dir(location), "environment")); err == nil && len(bytes.TrimSpace(selected)) > 0 {
+		workspace = string(bytes.TrimSpace(selected))
+	}
+
+	src, err := readBackend(ctx, pointer.Backend.Type, pointer.Backend.Config, workspace)
+	if err == errUnsupportedBackend {
+		// Terraform itself reads every backend
+		return pullState(ctx, workingDir(location))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tfstate from the %s backend: %v", pointer.Backend.Type, err)
+	}
+	defer src.Close()
+	return io.ReadAll(src)
+}
+
+var errUnsupportedBackend = fmt.Errorf("backend not supported")
+
+// readBackend reads the state of a workspace from a backend configured like in the terraform block.
+func readBackend(ctx context.Context, backend string, config map[string]interface{}, workspace string) (io.ReadCloser, error) {
+	setting := func(name string) string {
+		value, _ := config[name].(string)
+		return value
+	}
+	workspacePrefix := func() string {
+		if prefix, ok := config["workspace_key_prefix"].(string); ok {
+			return prefix
+		}
+		return "env:"
+	}
+
+	switch backend {
+	case "s3":
+		key := setting("key")
+		if workspace != defaultWorkspace {
+			key = path.Join(workspacePrefix(), workspace, key)
+		}
+		return readS3(ctx, setting("bucket"), key, setting("region"), setting("role_arn"))
+	case "gcs":
+		key := path.Join(setting("prefix"), workspace+".tfstate")
+		return readGCS(ctx, setting("bucket"), key, setting("credentials"), setting("encryption_key"))
+	case "azurerm":
+		key := setting("key")
+		if workspace != defaultWorkspace {
+			key += workspacePrefix() + workspace
+		}
+		return readAzureRM(ctx, setting("resource_group_name"), setting("storage_account_name"), setting("container_name"), key, azureRMOptions{
+			accessKey:      setting("access_key"),
+			useAzureAD:     setting("use_azuread_auth") == "true",
+			subscriptionID: setting("subscription_id"),
+		})
+	case "remote":
+		token := setting("token")
+		if token == "" {
+			token = os.Getenv("TFE_TOKEN")
+		}
+		workspaces, _ := config["workspaces"].(map[string]interface{})
+		if name, _ := workspaces["name"].(string); name != "" {
+			return readTFE(ctx, setting("hostname"), setting("organization"), name, token)
+		}
+		if prefix, _ := workspaces["prefix"].(string); prefix != "" {
+			return readTFE(ctx, setting("hostname"), setting("organization"), prefix+workspace, token)
+		}
+		return nil, fmt.Errorf("workspaces requires either name or prefix")
+	default:
+		return nil, errUnsupportedBackend
+	}
+}
+
+// workingDir returns the directory terraform was initialized in for a state file, the parent of .terraform
+func workingDir(location string) string {
+	dir := filepath.Dir(location)
+	if filepath.Base(dir) == ".terraform" {
+		return filepath.Dir(dir)
+	}
+	return dir
+}
+
+// pullState invokes "terraform state pull" in dirPath and returns the state of the selected workspace.
+func pullState(ctx context.Context, dirPath string) ([]byte, error) {
+	terraformPath, err := exec.LookPath("terraform")
+	if err != nil {
+		return nil, fmt.Errorf("failed to find terraform executable in PATH: %v", err)
+	}
+
+	cmd := exec.CommandContext(ctx, terraformPath, "state", "pull")
+	cmd.Dir = dirPath
+
+	var out, stderr bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("error running 'terraform state pull' in directory %s: %v, output: %s", dirPath, err, stderr.String())
+	}
+
+	return out.Bytes(), nil
+}
+
+// readHTTP downloads a state document served over http(s), with a bearer token if given.
+func readHTTP(ctx context.Context, u, token string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Add("Authorization", "Bearer "+token)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// readS3 reads an object of a bucket in any region, assuming roleARN first if given.
+func readS3(ctx context.Context, bucket, key, region, roleARN string) (io.ReadCloser, error) {
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(region))
+	if err != nil {
+		return nil, err
+	}
+
+	// The bucket may live in another region than the one configured
+	bucketRegion, err := manager.GetBucketRegion(ctx, s3.NewFromConfig(cfg), bucket)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Region = bucketRegion
+
+	if roleARN != "" {
+		cfg.Credentials = stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), roleARN)
+	}
+
+	result, err := s3.NewFromConfig(cfg).GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result.Body, nil
+}
+
+// readGCS reads an object of a bucket, with a credentials file and a base64 customer supplied key if given.
+func readGCS(ctx context.Context, bucket, key, credentials, encryptionKey string) (io.ReadCloser, error) {
+	var options []option.ClientOption
+	if credentials != "" {
+		options = append(options, option.WithCredentialsFile(credentials))
+	}
+	client, err := storage.NewClient(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+
+	object := client.Bucket(bucket).Object(key)
+	if encryptionKey != "" {
+		decoded, err := base64.StdEncoding.DecodeString(encryptionKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid encryption key: %v", err)
+		}
+		object = object.Key(decoded)
+	}
+	return object.NewReader(ctx)
+}
+
+// azureRMOptions are the settings of the azurerm backend telling how to authenticate.
+type azureRMOptions struct {
+	accessKey      string
+	useAzureAD     bool
+	subscriptionID string
+}
+
+// readAzureRM reads a blob, authenticating with Azure AD or with an access key of the storage account.
+func readAzureRM(ctx context.Context, resourceGroupName, accountName, containerName, key string, opts azureRMOptions) (io.ReadCloser, error) {
+	serviceURL := fmt.Sprintf("https://%s.blob.core.windows.net/", accountName)
+
+	var client *azblob.Client
+	if opts.useAzureAD || os.Getenv("ARM_USE_AZUREAD") == "true" {
+		cred, err := azidentity.NewDefaultAzureCredential(nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to authorize: %v", err)
+		}
+		client, err = azblob.NewClient(serviceURL, cred, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to setup client: %v", err)
+		}
+	} else {
+		accountKey, err := azureAccessKey(ctx, resourceGroupName, accountName, opts)
+		if err != nil {
+			return nil, err
+		}
+		credential, err := azblob.NewSharedKeyCredential(accountName, accountKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create credential: %v", err)
+		}
+		client, err = azblob.NewClientWithSharedKeyCredential(serviceURL, credential, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to setup client: %v", err)
+		}
+	}
+
+	resp, err := client.DownloadStream(ctx, containerName, key, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download blob: %v", err)
+	}
+	return resp.Body, nil
+}
+
+// azureAccessKey returns the configured access key, the one of AZURE_STORAGE_ACCESS_KEY or else the first key
+// listed for the storage account.
+func azureAccessKey(ctx context.Context, resourceGroupName, accountName string, opts azureRMOptions) (string, error) {
+	if opts.accessKey != "" {
+		return opts.accessKey, nil
+	}
+	if key := os.Getenv("AZURE_STORAGE_ACCESS_KEY"); key != "" {
+		return key, nil
+	}
+
+	subscriptionID := opts.subscriptionID
+	if subscriptionID == "" {
+		subscriptionID = os.Getenv("AZURE_SUBSCRIPTION_ID")
+	}
+	if subscriptionID == "" {
+		return "", fmt.Errorf("no subscription given, use azurerm://<subscription>@... or AZURE_SUBSCRIPTION_ID")
+	}
+
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to authorize: %v", err)
+	}
+	factory, err := armstorage.NewClientFactory(subscriptionID, cred, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create client factory: %v", err)
+	}
+	keys, err := factory.NewAccountsClient().ListKeys(ctx, resourceGroupName, accountName, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to list keys: %v", err)
+	}
+	if len(keys.Keys) == 0 || keys.Keys[0].Value == nil {
+		return "", fmt.Errorf("no access keys found for storage account %s", accountName)
+	}
+	return *keys.Keys[0].Value, nil
+}
+
+// readTFE reads the current state version of a Terraform Cloud or Enterprise workspace.
+func readTFE(ctx context.Context, hostname, organization, workspaceName, token string) (io.ReadCloser, error) {
+	address := tfe.DefaultAddress
+	if hostname != "" {
+		address = "https://" + hostname
+	}
+
+	client, err := tfe.NewClient(&tfe.Config{Address: address, Token: token})
+	if err != nil {
+		return nil, err
+	}
+
+	workspace, err := client.Workspaces.Read(ctx, organization, workspaceName)
+	if err != nil {
+		return nil, err
+	}
+	state, err := client.StateVersions.ReadCurrent(ctx, workspace.ID)
+	if err != nil {
+		return nil, err
+	}
+	return readHTTP(ctx, state.DownloadURL, token)
+}
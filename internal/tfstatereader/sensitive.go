@@ -0,0 +1,156 @@
+package tfstatereader
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/CiucurDaniel/terraview/internal/config"
+)
+
+// sensitiveStep is one step of a path in the sensitive_attributes of an instance, e.g.
+// {"type": "get_attr", "value": "admin_password"} or {"type": "index", "value": {"value": 0, "type": "number"}}
+type sensitiveStep struct {
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+// sensitivePaths returns the paths Terraform marked as sensitive for a resource instance, in the
+// notation used by redact, e.g. os_profile[0].admin_password or tags.secret
+// It returns false when the markers of the instance could not be read, e.g. without the raw state.
+func (h *TFStateHandler) sensitivePaths(resource string) (map[string]bool, bool) {
+	if h.Raw == nil {
+		return nil, false
+	}
+
+	for _, res := range h.Raw.Resources {
+		for _, instance := range res.Instances {
+			if res.InstanceAddress(instance) != resource {
+				continue
+			}
+			return parseSensitiveAttributes(instance.SensitiveAttributes)
+		}
+	}
+	return nil, false
+}
+
+// parseSensitiveAttributes converts the sensitive_attributes of an instance into paths.
+func parseSensitiveAttributes(data json.RawMessage) (map[string]bool, bool) {
+	paths := make(map[string]bool)
+	if len(data) == 0 {
+		return paths, true
+	}
+
+	var markers []json.RawMessage
+	if err := json.Unmarshal(data, &markers); err != nil {
+		return nil, false
+	}
+	for _, marker := range markers {
+		var steps []sensitiveStep
+		if err := json.Unmarshal(marker, &steps); err != nil {
+			// Some versions write single step paths as a plain step
+			var step sensitiveStep
+			if json.Unmarshal(marker, &step) != nil {
+				return nil, false
+			}
+			steps = []sensitiveStep{step}
+		}
+		path, ok := sensitivePath(steps)
+		if !ok {
+			return nil, false
+		}
+		paths[path] = true
+	}
+	return paths, true
+}
+
+// sensitivePath converts the steps of a marker into a path.
+func sensitivePath(steps []sensitiveStep) (string, bool) {
+	path := ""
+	for _, step := range steps {
+		switch step.Type {
+		case "get_attr":
+			var name string
+			if err := json.Unmarshal(step.Value, &name); err != nil {
+				return "", false
+			}
+			path = joinPath(path, name)
+		case "index":
+			var index struct {
+				Value interface{} `json:"value"`
+			}
+			if err := json.Unmarshal(step.Value, &index); err != nil {
+				return "", false
+			}
+			switch key := index.Value.(type) {
+			case string:
+				path = joinPath(path, key)
+			case float64:
+				path += fmt.Sprintf("[%d]", int(key))
+			default:
+				return "", false
+			}
+		default:
+			return "", false
+		}
+	}
+	return path, path != ""
+}
+
+// joinPath appends an attribute name or map key to a path.
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+// redact returns a copy of the attributes where every value marked sensitive in the state, or whose
+// name is sensitive according to the config, is replaced with config.SensitiveMask
+// When the markers are not known only the names tell, see warnUnmarked.
+func redact(attributes map[string]interface{}, marked map[string]bool, cfg *config.Config) map[string]interface{} {
+	if cfg.AllowSensitive {
+		return attributes
+	}
+	return redactValue(attributes, "", marked, cfg).(map[string]interface{})
+}
+
+func redactValue(value interface{}, path string, marked map[string]bool, cfg *config.Config) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, element := range v {
+			elementPath := joinPath(path, key)
+			if marked[elementPath] || cfg.IsSensitive(key) {
+				result[key] = maskValue(element)
+				continue
+			}
+			result[key] = redactValue(element, elementPath, marked, cfg)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, element := range v {
+			elementPath := fmt.Sprintf("%s[%d]", path, i)
+			if marked[elementPath] {
+				result[i] = maskValue(element)
+				continue
+			}
+			result[i] = redactValue(element, elementPath, marked, cfg)
+		}
+		return result
+	default:
+		return v
+	}
+}
+
+// maskValue masks a value, keeping empty values empty so labels do not show attributes which are not set.
+func maskValue(value interface{}) interface{} {
+	if value == nil {
+		return nil
+	}
+	if text, ok := value.(string); ok && strings.TrimSpace(text) == "" {
+		return text
+	}
+	return config.SensitiveMask
+}
@@ -0,0 +1,34 @@
+package tfstatereader
+
+import (
+	"testing"
+
+	"github.com/CiucurDaniel/terraview/internal/config"
+)
+
+func TestGetAttributesWithoutMarkers(t *testing.T) {
+	handler, err := NewTFStateHandler("testdata/sensitive.tfstate")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attributes, err := handler.GetAttributes("azurerm_linux_virtual_machine.vm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attributes["computer_name"] != config.SensitiveMask || attributes["admin_username"] != "azureuser" {
+		t.Errorf("markers were not applied: %v", attributes)
+	}
+
+	// A state whose markers are in an unknown format, like some remote states, is masked by name only
+	attributes, err = handler.GetAttributes("azurerm_linux_virtual_machine.legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attributes["admin_password"] != config.SensitiveMask || attributes["connection_string"] != config.SensitiveMask {
+		t.Errorf("attributes named like secrets were not masked: %v", attributes)
+	}
+	if attributes["size"] != "Standard_B1s" || attributes["admin_username"] != "azureuser" {
+		t.Errorf("attributes were masked without markers: %v", attributes)
+	}
+}
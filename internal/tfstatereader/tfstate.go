@@ -1,35 +1,44 @@
 package tfstatereader
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"log"
 	"strings"
+	"sync"
 
+	"github.com/CiucurDaniel/terraview/internal/address"
 	"github.com/CiucurDaniel/terraview/internal/config"
 	"github.com/fujiwara/tfstate-lookup/tfstate"
 )
 
 // TFStateHandler handles operations on the Terraform state file.
+// State is the state as read by tfstate-lookup and Raw the same document with what tfstate-lookup drops.
 type TFStateHandler struct {
 	StateFilePath string
 	State         *tfstate.TFState
+	Raw           *RawState
+
+	warnUnmarked sync.Once // warns once that values are masked by name only
 }
 
-// NewTFStateHandler creates a new TFStateHandler.
+// NewTFStateHandler creates a new TFStateHandler for a local state file or a state URL.
 func NewTFStateHandler(stateFilePath string) (*TFStateHandler, error) {
 	// Create a context
 	ctx := context.Background()
 
-	// Read the Terraform state file from the appropriate source
-	var state *tfstate.TFState
-	var err error
-	if isURL(stateFilePath) {
-		state, err = tfstate.ReadURL(ctx, stateFilePath)
-	} else {
-		state, err = tfstate.ReadFile(ctx, stateFilePath)
+	// Read the Terraform state document once from the appropriate source
+	data, err := readStateBytes(ctx, stateFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading tfstate file: %v", err)
 	}
 
+	state, err := tfstate.Read(ctx, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("error reading tfstate file: %v", err)
+	}
+	raw, err := parseRawState(data)
 	if err != nil {
 		return nil, fmt.Errorf("error reading tfstate file: %v", err)
 	}
@@ -37,6 +46,7 @@ func NewTFStateHandler(stateFilePath string) (*TFStateHandler, error) {
 	return &TFStateHandler{
 		StateFilePath: stateFilePath,
 		State:         state,
+		Raw:           raw,
 	}, nil
 }
 
@@ -47,68 +57,96 @@ func isURL(path string) bool {
 		strings.HasPrefix(path, "azurerm://") || strings.HasPrefix(path, "remote://")
 }
 
-// GetImportantAttributes retrieves important attributes for a given resource.
-func (h *TFStateHandler) GetImportantAttributes(resource string) ([]string, error) {
+// GetAttributes retrieves all attributes recorded in the state for a resource instance.
+// Sensitive values are masked unless the config allows them.
+func (h *TFStateHandler) GetAttributes(resource string) (map[string]interface{}, error) {
 	cfg := config.GetConfig()
 	if cfg == nil {
 		return nil, fmt.Errorf("config not loaded")
 	}
 
-	// List
-	//fmt.Println("Listing resources")
-	//fmt.Println(h.State.List())
-
-	// Find the resource in the state
 	obj, err := h.State.Lookup(resource)
 	if err != nil {
 		return nil, fmt.Errorf("resource %s not found in tfstate: %v", resource, err)
 	}
 
-	attributesMap := obj.Value.(map[string]interface{})
+	attributesMap, ok := obj.Value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("resource %s not found in tfstate", resource)
+	}
+
+	marked, known := h.sensitivePaths(resource)
+	if !known && !cfg.AllowSensitive {
+		h.warnUnmarked.Do(func() {
+			log.Printf("WARNING: the sensitive markers of %s could not be read, only attributes named like secrets are masked", resource)
+		})
+	}
+	return redact(attributesMap, marked, cfg), nil
+}
+
+// GetImportantAttributes retrieves important attributes for a given resource.
+func (h *TFStateHandler) GetImportantAttributes(resource string) ([]string, error) {
+	cfg := config.GetConfig()
+	if cfg == nil {
+		return nil, fmt.Errorf("config not loaded")
+	}
+
+	// Find the resource in the state
+	attributesMap, err := h.GetAttributes(resource)
+	if err != nil {
+		return nil, err
+	}
 
 	// Extract important attributes based on config
-	resourceType := strings.Split(resource, ".")[0]
+	addr, err := address.Parse(resource)
+	if err != nil {
+		return nil, err
+	}
 
 	var importantAttrs []string
-	for _, resConfig := range cfg.ImportantAttributes {
-		if resConfig.Name == resourceType {
-			for _, attr := range resConfig.Attributes {
-				// Directly access the attribute value from the attributes map
-				if value, ok := attributesMap[attr]; ok {
-					importantAttrs = append(importantAttrs, fmt.Sprintf("%s: %s", attr, value))
-				} else {
-					log.Printf("Attribute %s not found for resource %s", attr, resource)
-				}
-			}
-			break
+	for _, attr := range cfg.AttributesFor(addr.Type) {
+		// Evaluate the attribute path against the attributes map
+		values, err := EvaluatePath(attributesMap, attr)
+		if err != nil {
+			log.Printf("Invalid attribute %s: %v", attr, err)
+			continue
 		}
-	}
 
-	if len(importantAttrs) == 0 {
-		return nil, fmt.Errorf("no important attributes found for resource %s", resource)
+		var formatted []string
+		for _, value := range values {
+			if text := FormatValue(value); text != "" {
+				formatted = append(formatted, text)
+			}
+		}
+		// Wildcard entries name attributes many of the matched types do not have
+		if len(formatted) == 0 {
+			continue
+		}
+		importantAttrs = append(importantAttrs, fmt.Sprintf("%s: %s", attr, strings.Join(formatted, ", ")))
 	}
 
 	return importantAttrs, nil
 }
 
-// IsCreatedWithList checks if a resource was created with a count or for_each.
+// IsCreatedWithList checks if a resource was expanded into several instances, or instances with keys, by a
+// count or for_each on the resource itself or on one of the modules it lives in.
 func (h *TFStateHandler) IsCreatedWithList(resource string) bool {
-	resourceList, err := h.State.List()
+	instances, err := h.GetListOfNamesForResource(resource)
 	if err != nil {
-		log.Printf("error listing resources: %v", err)
 		return false
 	}
-
-	for _, res := range resourceList {
-		if strings.HasPrefix(res, resource+"[") || strings.HasPrefix(res, resource+"[\"") {
-			return true
-		}
-	}
-	return false
+	return len(instances) != 1 || instances[0] != resource
 }
 
-// GetListOfNamesForResource returns the list of actual names for a resource created with count or for_each.
+// GetListOfNamesForResource returns the addresses of the instances of a resource recorded in the state, matching
+// module instances too, e.g. module.net[0].azurerm_subnet.this and module.net[1].azurerm_subnet.this for
+// module.net.azurerm_subnet.this
 func (h *TFStateHandler) GetListOfNamesForResource(resource string) ([]string, error) {
+	addr, err := address.Parse(resource)
+	if err != nil {
+		return nil, err
+	}
+
 	resourceList, err := h.State.List()
 	if err != nil {
 		return nil, fmt.Errorf("error listing resources: %v", err)
@@ -116,7 +154,8 @@ func (h *TFStateHandler) GetListOfNamesForResource(resource string) ([]string, e
 
 	var resourceNames []string
 	for _, res := range resourceList {
-		if strings.HasPrefix(res, resource+"[") || strings.HasPrefix(res, resource+"[\"") {
+		instance, err := address.Parse(res)
+		if err == nil && addr.Covers(instance) {
 			resourceNames = append(resourceNames, res)
 		}
 	}
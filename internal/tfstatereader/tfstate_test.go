@@ -0,0 +1,101 @@
+package tfstatereader
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestBuildGraphWithModuleInstances(t *testing.T) {
+	handler, err := NewTFStateHandler("testdata/modules.tfstate")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	graph, err := handler.BuildGraph()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var edges []string
+	for _, edge := range graph.Edges.Edges {
+		edges = append(edges, edge.Src+" -> "+edge.Dst)
+	}
+	sort.Strings(edges)
+
+	// Each subnet depends on the network of its own module instance only
+	want := []string{
+		`"module.net[0].azurerm_subnet.sn" -> "module.net[0].azurerm_virtual_network.vnet"`,
+		`"module.net[0].azurerm_virtual_network.vnet" -> "azurerm_resource_group.rg"`,
+		`"module.net[1].azurerm_subnet.sn" -> "module.net[1].azurerm_virtual_network.vnet"`,
+		`"module.net[1].azurerm_virtual_network.vnet" -> "azurerm_resource_group.rg"`,
+	}
+	if !reflect.DeepEqual(edges, want) {
+		t.Errorf("edges = %v, want %v", edges, want)
+	}
+	if len(graph.Nodes.Nodes) != 5 {
+		t.Errorf("graph has %d nodes, want 5", len(graph.Nodes.Nodes))
+	}
+}
+
+func TestNewTFStateHandlerFromURL(t *testing.T) {
+	server := httptest.NewServer(http.FileServer(http.Dir("testdata")))
+	defer server.Close()
+
+	handler, err := NewTFStateHandler(server.URL + "/modules.tfstate")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The document tfstate-lookup reads is the raw one, so remote states have dependencies too
+	if names, _ := handler.State.List(); len(names) != 5 {
+		t.Errorf("state lists %v", names)
+	}
+	graph, err := handler.BuildGraph()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(graph.Edges.Edges) != 4 {
+		t.Errorf("graph has %d edges, want 4", len(graph.Edges.Edges))
+	}
+}
+
+func TestGetListOfNamesForResource(t *testing.T) {
+	handler, err := NewTFStateHandler("testdata/modules.tfstate")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names, err := handler.GetListOfNamesForResource("module.net.azurerm_subnet.sn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"module.net[0].azurerm_subnet.sn", "module.net[1].azurerm_subnet.sn"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("names = %v, want %v", names, want)
+	}
+}
+
+func TestReferences(t *testing.T) {
+	handler, err := NewTFStateHandler("testdata/references.tfstate")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	references, err := handler.References()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The id of the resource group is shared with the data source reading it, so it tells nothing
+	want := []Reference{
+		{From: "azurerm_linux_virtual_machine.vm", To: "azurerm_network_interface.nic[1]", Attribute: "network_interface_ids"},
+		{From: "azurerm_network_interface.nic[0]", To: `azurerm_subnet.sn["web"]`, Attribute: "subnet_id"},
+		{From: "azurerm_network_interface.nic[1]", To: `azurerm_subnet.sn["app"]`, Attribute: "subnet_id"},
+	}
+	if !reflect.DeepEqual(references, want) {
+		t.Errorf("references = %v, want %v", references, want)
+	}
+}
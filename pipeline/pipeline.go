@@ -0,0 +1,58 @@
+// Package pipeline lets Go programs embedding terraview register their own passes, which can then be used
+// in the pipeline section of terraview.yaml like the built-in ones. A pass changes the diagram in place:
+//
+//	func main() {
+//		pipeline.Register("owner_labels", func(d *pipeline.Diagram, ctx *pipeline.Context) error {
+//			for _, node := range d.Instances() {
+//				node.Label += "\nowner: platform"
+//			}
+//			return nil
+//		})
+//		cmd.Execute()
+//	}
+//
+// with
+//
+//	pipeline:
+//	  - pass: graph_attributes
+//	  # ...
+//	  - pass: owner_labels
+package pipeline
+
+import (
+	"github.com/CiucurDaniel/terraview/internal/diagram"
+	"github.com/CiucurDaniel/terraview/internal/graph"
+)
+
+// Types of the diagram passes work on, see their documentation in internal/diagram.
+type (
+	Diagram  = diagram.Diagram
+	Resource = diagram.Resource
+	Node     = diagram.Node
+	Group    = diagram.Group
+	Edge     = diagram.Edge
+	Attrs    = diagram.Attrs
+)
+
+// Types of passes and what they get to work with.
+type (
+	Pass    = graph.Pass
+	Context = graph.PassContext
+	Params  = graph.Params
+)
+
+// Register makes a pass available to the pipeline section under name. It must be called before the command runs,
+// typically from main or an init function, and fails for a name which is already taken.
+func Register(name string, pass Pass) error {
+	return graph.RegisterPass(name, pass)
+}
+
+// Passes returns the names of every registered pass, built-in ones included.
+func Passes() []string {
+	return graph.RegisteredPasses()
+}
+
+// Default returns the names of the passes run when the configuration has no pipeline section, in order.
+func Default() []string {
+	return append([]string(nil), graph.DefaultPipeline...)
+}